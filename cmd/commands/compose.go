@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/compose-spec/compose-go/cli"
+	dockercli "github.com/docker/cli/cli"
 	"github.com/docker/cli/cli/command"
 	amazon "github.com/docker/ecs-plugin/pkg/amazon/backend"
 	"github.com/docker/ecs-plugin/pkg/amazon/cloudformation"
@@ -29,6 +30,8 @@ func ComposeCommand(dockerCli command.Cli) *cobra.Command {
 		DownCommand(dockerCli, opts),
 		LogsCommand(dockerCli, opts),
 		PsCommand(dockerCli, opts),
+		RunCommand(dockerCli, opts),
+		ExecCommand(dockerCli, opts),
 	)
 	return cmd
 }
@@ -115,6 +118,47 @@ func PsCommand(dockerCli command.Cli, options *composeOptions) *cobra.Command {
 	return cmd
 }
 
+func RunCommand(dockerCli command.Cli, options *composeOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "run SERVICE [COMMAND...]",
+		Short: "Run a one-off task from a service",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: WithAwsContext(dockerCli, func(clusteropts docker.AwsContext, backend *amazon.Backend, args []string) error {
+			opts, err := options.toProjectOptions()
+			if err != nil {
+				return err
+			}
+			exitCode, err := backend.Run(context.Background(), opts, args[0], args[1:], os.Stdout)
+			if err != nil {
+				return err
+			}
+			if exitCode != 0 {
+				return dockercli.StatusError{StatusCode: exitCode}
+			}
+			return nil
+		}),
+	}
+	cmd.Flags().SetInterspersed(false)
+	return cmd
+}
+
+func ExecCommand(dockerCli command.Cli, options *composeOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exec SERVICE [COMMAND...]",
+		Short: "Execute a command in a running container of a service",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: WithAwsContext(dockerCli, func(clusteropts docker.AwsContext, backend *amazon.Backend, args []string) error {
+			opts, err := options.toProjectOptions()
+			if err != nil {
+				return err
+			}
+			return backend.Exec(context.Background(), opts, args[0], args[1:])
+		}),
+	}
+	cmd.Flags().SetInterspersed(false)
+	return cmd
+}
+
 type downOptions struct {
 	DeleteCluster bool
 }
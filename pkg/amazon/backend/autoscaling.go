@@ -0,0 +1,169 @@
+package backend
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/awslabs/goformation/v4/cloudformation"
+	autoscalingapi "github.com/awslabs/goformation/v4/cloudformation/applicationautoscaling"
+	"github.com/awslabs/goformation/v4/cloudformation/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation/iam"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/mitchellh/mapstructure"
+)
+
+// AutoScalingRole is the role application auto scaling assumes to update services desired count
+const AutoScalingRole = "AutoScalingRole"
+
+// autoScaling is the content of the x-aws-autoscaling deploy extension
+type autoScaling struct {
+	Min int `mapstructure:"min"`
+	Max int `mapstructure:"max"`
+	// CPU is the target average CPU utilization in percent
+	CPU int `mapstructure:"cpu"`
+	// Memory is the target average memory utilization in percent
+	Memory int `mapstructure:"memory"`
+	// Requests is the target number of requests per task, as counted by the application load balancer
+	Requests int `mapstructure:"requests"`
+}
+
+type targetTracking struct {
+	metric *autoscalingapi.ScalingPolicy_PredefinedMetricSpecification
+	target int
+}
+
+func getAutoScaling(service types.ServiceConfig) (*autoScaling, error) {
+	if service.Deploy == nil {
+		return nil, nil
+	}
+	ext, ok := service.Deploy.Extensions[compose.ExtensionAutoScaling]
+	if !ok {
+		return nil, nil
+	}
+	scaling := &autoScaling{}
+	if err := mapstructure.Decode(ext, scaling); err != nil {
+		return nil, fmt.Errorf("service %s: invalid %s: %s", service.Name, compose.ExtensionAutoScaling, err)
+	}
+	if scaling.Max < 1 || scaling.Max < scaling.Min {
+		return nil, fmt.Errorf("service %s: %s max must be positive and greater than min", service.Name, compose.ExtensionAutoScaling)
+	}
+	if scaling.CPU == 0 && scaling.Memory == 0 && scaling.Requests == 0 {
+		return nil, fmt.Errorf("service %s: %s requires a cpu, memory or requests target", service.Name, compose.ExtensionAutoScaling)
+	}
+	return scaling, nil
+}
+
+// createAutoScaling registers the service as a scalable target, with a target tracking policy for each metric set
+// by x-aws-autoscaling
+func createAutoScaling(project *types.Project, service types.ServiceConfig, template *cloudformation.Template, scaling *autoScaling, cluster string, loadBalancerARN string, targetGroups []string) error {
+	name := serviceLogicalName(project, service.Name)
+	policies := map[string]targetTracking{}
+	if scaling.CPU > 0 {
+		policies["CPU"] = targetTracking{
+			metric: &autoscalingapi.ScalingPolicy_PredefinedMetricSpecification{
+				PredefinedMetricType: applicationautoscaling.MetricTypeEcsserviceAverageCpuutilization,
+			},
+			target: scaling.CPU,
+		}
+	}
+	if scaling.Memory > 0 {
+		policies["Memory"] = targetTracking{
+			metric: &autoscalingapi.ScalingPolicy_PredefinedMetricSpecification{
+				PredefinedMetricType: applicationautoscaling.MetricTypeEcsserviceAverageMemoryUtilization,
+			},
+			target: scaling.Memory,
+		}
+	}
+	if scaling.Requests > 0 {
+		if len(targetGroups) == 0 || getLoadBalancerType(project) != elbv2.LoadBalancerTypeEnumApplication {
+			return fmt.Errorf("service %s: %s requests target requires the service to be exposed by an application load balancer", service.Name, compose.ExtensionAutoScaling)
+		}
+		policies["Requests"] = targetTracking{
+			metric: &autoscalingapi.ScalingPolicy_PredefinedMetricSpecification{
+				PredefinedMetricType: applicationautoscaling.MetricTypeAlbrequestCountPerTarget,
+				// app/<load-balancer-name>/<id>/targetgroup/<target-group-name>/<id>
+				ResourceLabel: cloudformation.Join("/", []string{
+					cloudformation.Select("1", []string{cloudformation.Split("loadbalancer/", loadBalancerARN)}),
+					cloudformation.GetAtt(targetGroups[0], "TargetGroupFullName"),
+				}),
+			},
+			target: scaling.Requests,
+		}
+	}
+
+	createAutoScalingRole(template)
+	scalableTarget := fmt.Sprintf("%sScalableTarget", name)
+	template.Resources[scalableTarget] = &autoscalingapi.ScalableTarget{
+		MaxCapacity:       scaling.Max,
+		MinCapacity:       scaling.Min,
+		ResourceId:        cloudformation.Join("/", []string{"service", cluster, cloudformation.GetAtt(serviceResourceName(project, service.Name), "Name")}),
+		RoleARN:           cloudformation.GetAtt(AutoScalingRole, "Arn"),
+		ScalableDimension: applicationautoscaling.ScalableDimensionEcsServiceDesiredCount,
+		ServiceNamespace:  applicationautoscaling.ServiceNamespaceEcs,
+	}
+
+	for metric, policy := range policies {
+		policyName := fmt.Sprintf("%s%sScalingPolicy", name, metric)
+		template.Resources[policyName] = &autoscalingapi.ScalingPolicy{
+			PolicyName:      fmt.Sprintf("%s-%s", service.Name, metric),
+			PolicyType:      applicationautoscaling.PolicyTypeTargetTrackingScaling,
+			ScalingTargetId: cloudformation.Ref(scalableTarget),
+			TargetTrackingScalingPolicyConfiguration: &autoscalingapi.ScalingPolicy_TargetTrackingScalingPolicyConfiguration{
+				PredefinedMetricSpecification: policy.metric,
+				TargetValue:                   float64(policy.target),
+			},
+		}
+	}
+	return nil
+}
+
+// keepScaledDesiredCounts removes the desired count of the deployed services scaled by x-aws-autoscaling, so updating
+// the stack doesn't reset the desired count auto scaling set
+func keepScaledDesiredCounts(project *types.Project, template *cloudformation.Template, resources map[string]string) error {
+	for _, service := range project.Services {
+		scaling, err := getAutoScaling(service)
+		if err != nil {
+			return err
+		}
+		name := serviceResourceName(project, service.Name)
+		if _, ok := resources[name]; !ok || scaling == nil {
+			continue
+		}
+		if s, ok := template.Resources[name].(*ecs.Service); ok {
+			s.DesiredCount = 0
+		}
+	}
+	return nil
+}
+
+func createAutoScalingRole(template *cloudformation.Template) {
+	if _, ok := template.Resources[AutoScalingRole]; ok {
+		return
+	}
+	template.Resources[AutoScalingRole] = &iam.Role{
+		AssumeRolePolicyDocument: assumeRolePolicy("application-autoscaling.amazonaws.com"),
+		Policies: []iam.Role_Policy{
+			{
+				PolicyDocument: &PolicyDocument{
+					Version: "2012-10-17",
+					Statement: []PolicyStatement{
+						{
+							Effect: "Allow",
+							Action: []string{
+								ActionDescribeServices,
+								ActionUpdateService,
+								ActionDescribeAlarms,
+								ActionPutMetricAlarm,
+								ActionDeleteAlarms,
+							},
+							Resource: []string{"*"},
+						},
+					},
+				},
+				PolicyName: "ScaleServices",
+			},
+		},
+	}
+}
@@ -0,0 +1,290 @@
+package backend
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/awslabs/goformation/v4/cloudformation"
+	"github.com/compose-spec/compose-go/types"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/builder/dockerignore"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/fileutils"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/docker/ecs-plugin/pkg/progress"
+)
+
+// buildImages builds the services which have a build section with the local Docker engine, pushes them to an ECR
+// repository per service, then returns the image parameters set to the pushed digests so the deployment is
+// reproducible
+func (b *Backend) buildImages(ctx context.Context, project *types.Project) (map[string]string, error) {
+	var (
+		docker      *client.Client
+		credentials compose.RegistryCredentials
+		err         error
+	)
+	images := map[string]string{}
+	w := progress.ContextWriter(ctx)
+	for _, service := range project.Services {
+		if service.Build == nil {
+			continue
+		}
+		if docker == nil {
+			docker, err = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+			if err != nil {
+				return nil, err
+			}
+			defer docker.Close()
+			credentials, err = b.api.GetRegistryCredentials(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		name := repositoryName(project, service)
+		w.Event(progress.Event{
+			ID:         name,
+			Status:     progress.Working,
+			StatusText: "Building",
+		})
+		repository, err := b.api.CreateRepository(ctx, name, project.Name)
+		if err != nil {
+			return nil, err
+		}
+		tag := fmt.Sprintf("%s:latest", repository)
+		if err := buildImage(ctx, docker, project, service, tag, &eventWriter{writer: w, id: name}); err != nil {
+			return nil, fmt.Errorf("service %s: failed to build image: %s", service.Name, err)
+		}
+
+		w.Event(progress.Event{
+			ID:         name,
+			Status:     progress.Working,
+			StatusText: "Pushing",
+		})
+		digest, err := pushImage(ctx, docker, tag, credentials, &eventWriter{writer: w, id: name})
+		if err != nil {
+			return nil, fmt.Errorf("service %s: failed to push image: %s", service.Name, err)
+		}
+		images[imageParameterName(project, service.Name)] = fmt.Sprintf("%s@%s", repository, digest)
+		w.Event(progress.Event{
+			ID:         name,
+			Status:     progress.Done,
+			StatusText: fmt.Sprintf("Pushed %s", digest),
+		})
+	}
+	return images, nil
+}
+
+// eventWriter reports each line of the output of the engine as the status of a progress event
+type eventWriter struct {
+	writer progress.Writer
+	id     string
+	line   []byte
+}
+
+func (e *eventWriter) Write(p []byte) (int, error) {
+	e.line = append(e.line, p...)
+	for {
+		i := bytes.IndexByte(e.line, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		text := strings.TrimSpace(string(e.line[:i]))
+		e.line = e.line[i+1:]
+		if text != "" {
+			e.writer.Event(progress.Event{
+				ID:         e.id,
+				Status:     progress.Working,
+				StatusText: text,
+			})
+		}
+	}
+}
+
+// createImageParameters adds a parameter for the image of each service which has a build section, which up sets to
+// the digest it pushes. Convert can't know this digest, so the parameter has no default.
+func createImageParameters(project *types.Project, template *cloudformation.Template) {
+	for _, service := range project.Services {
+		if service.Build == nil {
+			continue
+		}
+		template.Parameters[imageParameterName(project, service.Name)] = cloudformation.Parameter{
+			Type:        "String",
+			Description: fmt.Sprintf("Image of service %s, pushed to ECR repository %s by up", service.Name, repositoryName(project, service)),
+		}
+	}
+}
+
+func imageParameterName(project *types.Project, service string) string {
+	return fmt.Sprintf("Parameter%sImage", serviceLogicalName(project, service))
+}
+
+// repositoryName is the ECR repository service images are pushed to, which names must be lowercase
+func repositoryName(project *types.Project, service types.ServiceConfig) string {
+	return strings.ToLower(fmt.Sprintf("%s/%s", project.Name, service.Name))
+}
+
+// buildImage builds a service image from its local build context, honoring .dockerignore as docker build does
+func buildImage(ctx context.Context, docker *client.Client, project *types.Project, service types.ServiceConfig, tag string, out io.Writer) error {
+	contextDir := project.RelativePath(service.Build.Context)
+	dockerfile := service.Build.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	if filepath.IsAbs(dockerfile) {
+		rel, err := filepath.Rel(contextDir, dockerfile)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("dockerfile %s must be within build context %s", dockerfile, contextDir)
+		}
+		dockerfile = rel
+	}
+	dockerfile = filepath.ToSlash(dockerfile)
+
+	buildContext, err := createBuildContext(contextDir, dockerfile)
+	if err != nil {
+		return err
+	}
+	defer buildContext.Close()
+
+	response, err := docker.ImageBuild(ctx, buildContext, dockertypes.ImageBuildOptions{
+		Tags:        []string{tag},
+		Dockerfile:  dockerfile,
+		BuildArgs:   service.Build.Args,
+		Labels:      service.Build.Labels,
+		CacheFrom:   service.Build.CacheFrom,
+		ExtraHosts:  service.Build.ExtraHosts.AsList(),
+		NetworkMode: service.Build.Network,
+		Target:      service.Build.Target,
+		Remove:      true,
+	})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return jsonmessage.DisplayJSONMessagesStream(response.Body, out, 0, false, nil)
+}
+
+// createBuildContext streams a tar archive of the build context, without the files excluded by .dockerignore. The
+// Dockerfile and .dockerignore are always sent, as the engine requires them.
+func createBuildContext(contextDir string, dockerfile string) (io.ReadCloser, error) {
+	excludes := []string{}
+	if f, err := os.Open(filepath.Join(contextDir, ".dockerignore")); err == nil {
+		excludes, err = dockerignore.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	matcher, err := fileutils.NewPatternMatcher(excludes)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(contextDir, dockerfile)); err != nil {
+		return nil, fmt.Errorf("cannot locate Dockerfile: %s", err)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		archive := tar.NewWriter(writer)
+		err := filepath.Walk(contextDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(contextDir, path)
+			if err != nil || rel == "." {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if rel != dockerfile && rel != ".dockerignore" {
+				excluded, err := matcher.Matches(rel)
+				if err != nil {
+					return err
+				}
+				if excluded {
+					if info.IsDir() && !matcher.Exclusions() {
+						return filepath.SkipDir
+					}
+					// an exclusion pattern may still include some of the directory content
+					return nil
+				}
+			}
+
+			link := ""
+			if info.Mode()&os.ModeSymlink != 0 {
+				if link, err = os.Readlink(path); err != nil {
+					return err
+				}
+			}
+			header, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			header.Name = rel
+			header.Uid, header.Gid = 0, 0
+			header.Uname, header.Gname = "", ""
+			if err := archive.WriteHeader(header); err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(archive, f)
+			return err
+		})
+		if err == nil {
+			err = archive.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader, nil
+}
+
+// pushImage pushes an image to the registry and returns the digest it has been stored with
+func pushImage(ctx context.Context, docker *client.Client, tag string, credentials compose.RegistryCredentials, out io.Writer) (string, error) {
+	auth, err := json.Marshal(dockertypes.AuthConfig{
+		Username:      credentials.Username,
+		Password:      credentials.Password,
+		ServerAddress: credentials.ServerAddress,
+	})
+	if err != nil {
+		return "", err
+	}
+	stream, err := docker.ImagePush(ctx, tag, dockertypes.ImagePushOptions{
+		RegistryAuth: base64.URLEncoding.EncodeToString(auth),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	digest := ""
+	err = jsonmessage.DisplayJSONMessagesStream(stream, out, 0, false, func(message jsonmessage.JSONMessage) {
+		var result dockertypes.PushResult
+		if message.Aux != nil && json.Unmarshal(*message.Aux, &result) == nil && result.Digest != "" {
+			digest = result.Digest
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if digest == "" {
+		return "", fmt.Errorf("no digest returned by registry for %s", tag)
+	}
+	return digest, nil
+}
@@ -0,0 +1,111 @@
+package backend
+
+import (
+	"fmt"
+
+	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation/ecs"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	CapacityProviderFargate     = "FARGATE"
+	CapacityProviderFargateSpot = "FARGATE_SPOT"
+)
+
+// capacityProviderStrategyItem is an item of the x-aws-capacity_provider_strategy extension
+type capacityProviderStrategyItem struct {
+	CapacityProvider string `mapstructure:"capacity_provider"`
+	Weight           int    `mapstructure:"weight"`
+	Base             int    `mapstructure:"base"`
+}
+
+// getCapacityProviderStrategy decodes the x-aws-capacity_provider_strategy extension, returns nil when not set
+func getCapacityProviderStrategy(extensions map[string]interface{}) ([]capacityProviderStrategyItem, error) {
+	ext, ok := extensions[compose.ExtensionCapacityProviderStrategy]
+	if !ok {
+		return nil, nil
+	}
+	strategy := []capacityProviderStrategyItem{}
+	if err := mapstructure.Decode(ext, &strategy); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", compose.ExtensionCapacityProviderStrategy, err)
+	}
+	if len(strategy) == 0 {
+		return nil, fmt.Errorf("%s requires at least one capacity provider", compose.ExtensionCapacityProviderStrategy)
+	}
+	base := false
+	for _, item := range strategy {
+		switch item.CapacityProvider {
+		case CapacityProviderFargate, CapacityProviderFargateSpot:
+		default:
+			return nil, fmt.Errorf("%s: unsupported capacity provider %q, must be one of %s or %s", compose.ExtensionCapacityProviderStrategy, item.CapacityProvider, CapacityProviderFargate, CapacityProviderFargateSpot)
+		}
+		if item.Base > 0 {
+			if base {
+				return nil, fmt.Errorf("%s: only one capacity provider can have a base defined", compose.ExtensionCapacityProviderStrategy)
+			}
+			base = true
+		}
+	}
+	return strategy, nil
+}
+
+// getServiceCapacityProviderStrategy returns the service capacity provider strategy, or the project one as default
+func getServiceCapacityProviderStrategy(project *types.Project, service types.ServiceConfig) ([]capacityProviderStrategyItem, error) {
+	strategy, err := getCapacityProviderStrategy(service.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %s", service.Name, err)
+	}
+	if strategy != nil {
+		return strategy, nil
+	}
+	return getCapacityProviderStrategy(project.Extensions)
+}
+
+func toClusterCapacityProviderStrategy(strategy []capacityProviderStrategyItem) []ecs.Cluster_CapacityProviderStrategyItem {
+	items := []ecs.Cluster_CapacityProviderStrategyItem{}
+	for _, item := range strategy {
+		items = append(items, ecs.Cluster_CapacityProviderStrategyItem{
+			Base:             item.Base,
+			CapacityProvider: item.CapacityProvider,
+			Weight:           item.Weight,
+		})
+	}
+	return items
+}
+
+func toServiceCapacityProviderStrategy(strategy []capacityProviderStrategyItem) []ecs.Service_CapacityProviderStrategyItem {
+	items := []ecs.Service_CapacityProviderStrategyItem{}
+	for _, item := range strategy {
+		items = append(items, ecs.Service_CapacityProviderStrategyItem{
+			Base:             item.Base,
+			CapacityProvider: item.CapacityProvider,
+			Weight:           item.Weight,
+		})
+	}
+	return items
+}
+
+// getLaunchType returns the launch type, or the capacity provider strategy, which are mutually exclusive, the tasks of a
+// service run with: capacity providers set by x-aws-capacity_provider_strategy, the EC2 instances set by x-aws-ec2
+// through their capacity provider ec2CapacityProvider, or Fargate by default
+func getLaunchType(project *types.Project, service types.ServiceConfig, ec2CapacityProvider string) (string, []capacityProviderStrategyItem, error) {
+	strategy, err := getServiceCapacityProviderStrategy(project, service)
+	if err != nil {
+		return "", nil, err
+	}
+	if usesEC2(project) {
+		strategy = []capacityProviderStrategyItem{
+			{
+				CapacityProvider: ec2CapacityProvider,
+				Weight:           1,
+			},
+		}
+	}
+	if strategy != nil {
+		return "", strategy, nil
+	}
+	return ecsapi.LaunchTypeFargate, nil, nil
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
@@ -14,13 +16,12 @@ import (
 	"github.com/awslabs/goformation/v4/cloudformation/ecs"
 	"github.com/awslabs/goformation/v4/cloudformation/elasticloadbalancingv2"
 	"github.com/awslabs/goformation/v4/cloudformation/iam"
-	"github.com/awslabs/goformation/v4/cloudformation/logs"
 	"github.com/awslabs/goformation/v4/cloudformation/secretsmanager"
 	cloudmap "github.com/awslabs/goformation/v4/cloudformation/servicediscovery"
 	"github.com/awslabs/goformation/v4/cloudformation/tags"
-	"github.com/compose-spec/compose-go/compatibility"
 	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compatibility"
 	"github.com/docker/ecs-plugin/pkg/compose"
 	"github.com/sirupsen/logrus"
 )
@@ -28,16 +29,57 @@ import (
 const (
 	ParameterClusterName     = "ParameterClusterName"
 	ParameterVPCId           = "ParameterVPCId"
-	ParameterSubnet1Id       = "ParameterSubnet1Id"
-	ParameterSubnet2Id       = "ParameterSubnet2Id"
+	ParameterSubnetIds       = "ParameterSubnetIds"
 	ParameterLoadBalancerARN = "ParameterLoadBalancerARN"
+
+	ParameterLoadBalancerSubnetIds = "ParameterLoadBalancerSubnetIds"
+
+	// MinSubnets is the number of subnets, in distinct availability zones, required to deploy a project
+	MinSubnets = 2
+	// MaxZones is the number of availability zones of the largest regions, EFS file systems get a mount target in
+	// each zone tasks can run in
+	MaxZones = 6
+
+	// DefaultSSLPolicy is the security policy used by HTTPS listeners unless x-aws-ssl_policy is set
+	DefaultSSLPolicy = "ELBSecurityPolicy-2016-08"
+
+	UpdateOrderStartFirst = "start-first"
+	UpdateOrderStopFirst  = "stop-first"
+
+	FailureActionContinue = "continue"
+	FailureActionPause    = "pause"
+	FailureActionRollback = "rollback"
 )
 
 // Convert a compose project into a CloudFormation template
 func (b Backend) Convert(project *types.Project) (*cloudformation.Template, error) {
+	if err := check(project); err != nil {
+		return nil, err
+	}
+	return b.createTemplate(project)
+}
+
+// check a compose project can be converted, logging the attributes the conversion ignores
+func check(project *types.Project) error {
+	// services are loaded from a map, sort them so converting a project always gives the same template
+	sort.Slice(project.Services, func(i, j int) bool {
+		return project.Services[i].Name < project.Services[j].Name
+	})
+	removeUnusedDefaultNetwork(project)
+	if err := checkLogicalNames(project); err != nil {
+		return err
+	}
+	if err := checkVolumes(project); err != nil {
+		return err
+	}
+
+	supported := compatibleComposeAttributes
+	if usesEC2(project) {
+		supported = append(append([]string{}, compatibleComposeAttributes...), ec2ComposeAttributes...)
+	}
 	var checker compatibility.Checker = &FargateCompatibilityChecker{
 		compatibility.AllowList{
-			Supported: compatibleComposeAttributes,
+			Supported: supported,
 		},
 	}
 	compatibility.Check(project, checker)
@@ -49,9 +91,24 @@ func (b Backend) Convert(project *types.Project) (*cloudformation.Template, erro
 		}
 	}
 	if !compatibility.IsCompatible(checker) {
-		return nil, fmt.Errorf("compose file is incompatible with Amazon ECS")
+		return fmt.Errorf("compose file is incompatible with Amazon ECS")
 	}
+	return nil
+}
 
+// removeUnusedDefaultNetwork removes the default network the loader declares, when services only attach the networks
+// they declare, so it doesn't get a security group
+func removeUnusedDefaultNetwork(project *types.Project) {
+	for _, service := range project.Services {
+		if _, ok := service.Networks["default"]; ok {
+			return
+		}
+	}
+	delete(project.Networks, "default")
+}
+
+// createTemplate creates the CloudFormation template of a checked compose project
+func (b Backend) createTemplate(project *types.Project) (*cloudformation.Template, error) {
 	template := cloudformation.NewTemplate()
 	template.Description = "CloudFormation template created by Docker for deploying applications on Amazon ECS"
 	template.Parameters[ParameterClusterName] = cloudformation.Parameter{
@@ -64,38 +121,38 @@ func (b Backend) Convert(project *types.Project) (*cloudformation.Template, erro
 		Description: "ID of the VPC",
 	}
 
-	/*
-		FIXME can't set subnets: Ref("SubnetIds") see https://github.com/awslabs/goformation/issues/282
-		template.Parameters["SubnetIds"] = cloudformation.Parameter{
-			Type:        "List<AWS::EC2::Subnet::Id>",
-			Description: "The list of SubnetIds, for at least two Availability Zones in the region in your VPC",
-		}
-	*/
-	template.Parameters[ParameterSubnet1Id] = cloudformation.Parameter{
-		Type:        "AWS::EC2::Subnet::Id",
-		Description: "SubnetId, for Availability Zone 1 in the region in your VPC",
-	}
-	template.Parameters[ParameterSubnet2Id] = cloudformation.Parameter{
-		Type:        "AWS::EC2::Subnet::Id",
-		Description: "SubnetId, for Availability Zone 2 in the region in your VPC",
+	template.Parameters[ParameterSubnetIds] = cloudformation.Parameter{
+		Type:        "List<AWS::EC2::Subnet::Id>",
+		Description: "The list of SubnetIds, for at least two Availability Zones in the region in your VPC",
 	}
 
 	template.Parameters[ParameterLoadBalancerARN] = cloudformation.Parameter{
 		Type:        "String",
 		Description: "Name of the LoadBalancer to connect to (optional)",
 	}
+	template.Parameters[ParameterLoadBalancerSubnetIds] = cloudformation.Parameter{
+		Type:        "List<AWS::EC2::Subnet::Id>",
+		Description: "The list of SubnetIds for the LoadBalancer, for at least two Availability Zones in the region in your VPC",
+	}
 
 	// Create Cluster is `ParameterClusterName` parameter is not set
 	template.Conditions["CreateCluster"] = cloudformation.Equals("", cloudformation.Ref(ParameterClusterName))
 
-	cluster := createCluster(project, template)
+	cluster, err := createCluster(project, template)
+	if err != nil {
+		return nil, err
+	}
 
 	networks := map[string]string{}
-	for _, net := range project.Networks {
-		networks[net.Name] = convertNetwork(project, net, cloudformation.Ref(ParameterVPCId), template)
+	for name, net := range project.Networks {
+		securityGroup, err := convertNetwork(project, name, net, cloudformation.Ref(ParameterVPCId), template)
+		if err != nil {
+			return nil, err
+		}
+		networks[name] = securityGroup
 	}
 
-	for i, s := range project.Secrets {
+	for key, s := range project.Secrets {
 		if s.External.External {
 			continue
 		}
@@ -104,7 +161,7 @@ func (b Backend) Convert(project *types.Project) (*cloudformation.Template, erro
 			return nil, err
 		}
 
-		name := fmt.Sprintf("%sSecret", normalizeResourceName(s.Name))
+		name := fmt.Sprintf("%sSecret", secretLogicalName(project, key))
 		template.Resources[name] = &secretsmanager.Secret{
 			Description:  "",
 			SecretString: string(secret),
@@ -116,75 +173,199 @@ func (b Backend) Convert(project *types.Project) (*cloudformation.Template, erro
 			},
 		}
 		s.Name = cloudformation.Ref(name)
-		project.Secrets[i] = s
+		project.Secrets[key] = s
+	}
+
+	securityGroups := []string{}
+	for _, net := range networks {
+		securityGroups = append(securityGroups, net)
 	}
+	sort.Strings(securityGroups)
+	mountTargets := createVolumes(project, template, uniqueStrings(securityGroups))
+	createImageParameters(project, template)
 
-	createLogGroup(project, template)
+	instances, err := getEC2Instances(project)
+	if err != nil {
+		return nil, err
+	}
+	if instances != nil {
+		createEC2Instances(project, template, instances, cluster, uniqueStrings(securityGroups))
+	}
+
+	err = createLogGroups(project, template)
+	if err != nil {
+		return nil, err
+	}
 
 	// Private DNS namespace will allow DNS name for the services to be <service>.<project>.local
 	createCloudMap(project, template)
 
-	loadBalancerARN := createLoadBalancer(project, template)
+	loadBalancerARN, err := createLoadBalancer(project, template)
+	if err != nil {
+		return nil, err
+	}
+	listeners := listeners{}
+
+	sidecars, err := getSidecars(project)
+	if err != nil {
+		return nil, err
+	}
 
 	for _, service := range project.Services {
+		if sidecarOf(service) != "" {
+			// sidecar containers run within their parent service task
+			continue
+		}
+		containers := append([]types.ServiceConfig{service}, sidecars[service.Name]...)
 
-		definition, err := Convert(project, service)
+		definition, err := Convert(project, service, sidecars[service.Name]...)
 		if err != nil {
 			return nil, err
 		}
 
-		taskExecutionRole, err := createTaskExecutionRole(service, err, definition, template)
+		taskExecutionRole, err := createTaskExecutionRole(project, service, containers, definition, template)
 		if err != nil {
 			return template, err
 		}
 		definition.ExecutionRoleArn = cloudformation.Ref(taskExecutionRole)
 
-		taskDefinition := fmt.Sprintf("%sTaskDefinition", normalizeResourceName(service.Name))
-		template.Resources[taskDefinition] = definition
-
-		var healthCheck *cloudmap.Service_HealthCheckConfig
-		if service.HealthCheck != nil && !service.HealthCheck.Disable {
-			// FIXME ECS only support HTTP(s) health checks, while Docker only support CMD
+		exec, err := usesExec(containers)
+		if err != nil {
+			return nil, err
+		}
+		if taskRole := createTaskRole(project, service, containers, template, exec); taskRole != "" {
+			definition.TaskRoleArn = cloudformation.Ref(taskRole)
 		}
 
-		serviceRegistry := createServiceRegistry(service, template, healthCheck)
+		taskDefinition := taskDefinitionResourceName(project, service.Name)
+		template.Resources[taskDefinition] = definition
 
 		serviceSecurityGroups := []string{}
 		for net := range service.Networks {
 			serviceSecurityGroups = append(serviceSecurityGroups, networks[net])
 		}
+		sort.Strings(serviceSecurityGroups)
+
+		schedule, err := getSchedule(service)
+		if err != nil {
+			return nil, err
+		}
+		if schedule != "" {
+			// scheduled tasks run on EventBridge events, without a long-running service
+			if err := createScheduledTask(project, service, template, schedule, taskDefinition, serviceSecurityGroups, instances != nil); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		serviceRegistry := createServiceRegistry(project, service, template)
+
+		routing, err := getRouting(service)
+		if err != nil {
+			return nil, err
+		}
+
+		deploymentController, err := getDeploymentController(service)
+		if err != nil {
+			return nil, err
+		}
+		var blueGreen *blueGreenTarget
 
 		dependsOn := []string{}
+		targetGroups := []string{}
 		serviceLB := []ecs.Service_LoadBalancer{}
-		if len(service.Ports) > 0 {
-			for _, port := range service.Ports {
+		for _, container := range containers {
+			healthCheck, err := getLoadBalancerHealthCheck(container)
+			if err != nil {
+				return nil, err
+			}
+			for _, port := range container.Ports {
 				protocol := strings.ToUpper(port.Protocol)
+				targetProtocol := protocol
+				certificate, err := getCertificate(project, container)
+				if err != nil {
+					return nil, err
+				}
 				if getLoadBalancerType(project) == elbv2.LoadBalancerTypeEnumApplication {
 					protocol = elbv2.ProtocolEnumHttps
-					if port.Published == 80 {
+					if publishedPort(port) == 80 {
 						protocol = elbv2.ProtocolEnumHttp
 					}
+					// TLS is terminated by the load balancer
+					targetProtocol = elbv2.ProtocolEnumHttp
+					if port.Target == 443 {
+						logrus.Warnf("service %s: load balancer terminates TLS and forwards plain HTTP requests to container port 443", container.Name)
+					}
+				} else if certificate != "" && protocol == elbv2.ProtocolEnumTcp {
+					protocol = elbv2.ProtocolEnumTls
 				}
 				if loadBalancerARN != "" {
-					targetGroupName := createTargetGroup(project, service, port, template, protocol)
-					listenerName := createListener(service, port, template, targetGroupName, loadBalancerARN, protocol)
+					targetGroupName := createTargetGroup(project, container, port, template, targetProtocol, healthCheck)
+					listenerName, err := listeners.add(project, container, port, protocol, certificate, targetGroupName, routing)
+					if err != nil {
+						return nil, err
+					}
 					dependsOn = append(dependsOn, listenerName)
+					targetGroups = append(targetGroups, targetGroupName)
 					serviceLB = append(serviceLB, ecs.Service_LoadBalancer{
-						ContainerName:  service.Name,
+						ContainerName:  container.Name,
 						ContainerPort:  int(port.Target),
 						TargetGroupArn: cloudformation.Ref(targetGroupName),
 					})
+					if deploymentController == ecsapi.DeploymentControllerTypeCodeDeploy {
+						if blueGreen != nil {
+							return nil, fmt.Errorf("service %s: %s deployment only supports a single published port", service.Name, DeploymentBlueGreen)
+						}
+						test, err := getTestListener(service, port)
+						if err != nil {
+							return nil, err
+						}
+						blueGreen, err = addBlueGreenTarget(project, container, port, protocol, certificate, targetGroupName, template, listeners, test)
+						if err != nil {
+							return nil, err
+						}
+					}
 				}
 			}
 		}
+		if deploymentController == ecsapi.DeploymentControllerTypeCodeDeploy && blueGreen == nil {
+			return nil, fmt.Errorf("service %s: %s deployment requires a published port", service.Name, DeploymentBlueGreen)
+		}
 
 		desiredCount := 1
 		if service.Deploy != nil && service.Deploy.Replicas != nil {
 			desiredCount = int(*service.Deploy.Replicas)
 		}
 
-		for _, dependency := range service.DependsOn {
-			dependsOn = append(dependsOn, serviceResourceName(dependency))
+		scaling, err := getAutoScaling(service)
+		if err != nil {
+			return nil, err
+		}
+		if scaling != nil {
+			// start with the minimum number of tasks, auto scaling then adjusts the desired count, which up keeps once
+			// the service is deployed
+			desiredCount = scaling.Min
+			if err := createAutoScaling(project, service, template, scaling, cluster, loadBalancerARN, targetGroups); err != nil {
+				return nil, err
+			}
+		}
+
+		serviceDependsOn, err := getServiceDependsOn(project, service, containers, template, cluster)
+		if err != nil {
+			return nil, err
+		}
+		dependsOn = append(dependsOn, serviceDependsOn...)
+
+		for _, container := range containers {
+			for _, volume := range container.Volumes {
+				dependsOn = append(dependsOn, mountTargets[volume.Source]...)
+			}
+		}
+
+		healthCheckGracePeriod := 0
+		if len(serviceLB) > 0 && service.HealthCheck != nil && !service.HealthCheck.Disable {
+			// let the application start before load balancer health checks can mark the task unhealthy
+			healthCheckGracePeriod = durationToInt(service.HealthCheck.StartPeriod)
 		}
 
 		minPercent, maxPercent, err := computeRollingUpdateLimits(service)
@@ -192,32 +373,66 @@ func (b Backend) Convert(project *types.Project) (*cloudformation.Template, erro
 			return nil, err
 		}
 
-		template.Resources[serviceResourceName(service.Name)] = &ecs.Service{
-			AWSCloudFormationDependsOn: dependsOn,
-			Cluster:                    cluster,
-			DesiredCount:               desiredCount,
+		circuitBreaker, err := getDeploymentCircuitBreaker(service)
+		if err != nil {
+			return nil, err
+		}
+		if deploymentController == ecsapi.DeploymentControllerTypeCodeDeploy {
+			// CodeDeploy rolls back failed blue/green deployments
+			circuitBreaker = nil
+		}
+
+		assignPublicIP, err := getAssignPublicIP(project, service)
+		if err != nil {
+			return nil, err
+		}
+
+		launchType, strategy, err := getLaunchType(project, service, cloudformation.Ref(EC2CapacityProvider))
+		if err != nil {
+			return nil, err
+		}
+		platformVersion, err := getPlatformVersion(project, containers)
+		if err != nil {
+			return nil, err
+		}
+		if instances != nil {
+			dependsOn = append(dependsOn, EC2CapacityProviderAssociation)
+		}
+
+		taskDefinitionARN := cloudformation.Ref(taskDefinition)
+		if blueGreen != nil {
+			taskDefinitionARN = setDeployedTaskDefinition(project, service, template, taskDefinition)
+		}
+
+		template.Resources[serviceResourceName(project, service.Name)] = &ecs.Service{
+			AWSCloudFormationDependsOn:    uniqueStrings(dependsOn),
+			CapacityProviderStrategy:      toServiceCapacityProviderStrategy(strategy),
+			Cluster:                       cluster,
+			DesiredCount:                  desiredCount,
+			EnableExecuteCommand:          exec,
+			HealthCheckGracePeriodSeconds: healthCheckGracePeriod,
 			DeploymentController: &ecs.Service_DeploymentController{
-				Type: ecsapi.DeploymentControllerTypeEcs,
+				Type: deploymentController,
 			},
 			DeploymentConfiguration: &ecs.Service_DeploymentConfiguration{
-				MaximumPercent:        maxPercent,
-				MinimumHealthyPercent: minPercent,
+				DeploymentCircuitBreaker: circuitBreaker,
+				MaximumPercent:           maxPercent,
+				MinimumHealthyPercent:    minPercent,
 			},
-			LaunchType:    ecsapi.LaunchTypeFargate,
+			LaunchType:    launchType,
 			LoadBalancers: serviceLB,
 			NetworkConfiguration: &ecs.Service_NetworkConfiguration{
 				AwsvpcConfiguration: &ecs.Service_AwsVpcConfiguration{
-					AssignPublicIp: ecsapi.AssignPublicIpEnabled,
+					AssignPublicIp: assignPublicIP,
 					SecurityGroups: serviceSecurityGroups,
-					Subnets: []string{
-						cloudformation.Ref(ParameterSubnet1Id),
-						cloudformation.Ref(ParameterSubnet2Id),
-					},
+					Subnets:        []string{cloudformation.Ref(ParameterSubnetIds)},
 				},
 			},
-			PropagateTags:      ecsapi.PropagateTagsService,
-			SchedulingStrategy: ecsapi.SchedulingStrategyReplica,
-			ServiceRegistries:  []ecs.Service_ServiceRegistry{serviceRegistry},
+			PlacementStrategies: toPlacementStrategies(service.Deploy),
+			PlatformVersion:     platformVersion,
+			PropagateTags:       ecsapi.PropagateTagsService,
+			SchedulingStrategy:  ecsapi.SchedulingStrategyReplica,
+			ServiceRegistries:   []ecs.Service_ServiceRegistry{serviceRegistry},
 			Tags: []tags.Tag{
 				{
 					Key:   compose.ProjectTag,
@@ -228,22 +443,23 @@ func (b Backend) Convert(project *types.Project) (*cloudformation.Template, erro
 					Value: service.Name,
 				},
 			},
-			TaskDefinition: cloudformation.Ref(normalizeResourceName(taskDefinition)),
+			TaskDefinition: taskDefinitionARN,
 		}
-	}
-	return template, nil
-}
 
-func createLogGroup(project *types.Project, template *cloudformation.Template) {
-	retention := 0
-	if v, ok := project.Extensions[compose.ExtensionRetention]; ok {
-		retention = v.(int)
+		if blueGreen != nil {
+			createDeploymentGroup(project, service, template, cluster, blueGreen)
+		}
 	}
-	logGroup := fmt.Sprintf("/docker-compose/%s", project.Name)
-	template.Resources["LogGroup"] = &logs.LogGroup{
-		LogGroupName:    logGroup,
-		RetentionInDays: retention,
+
+	if loadBalancerARN != "" {
+		if err := listeners.createListeners(project, template, loadBalancerARN); err != nil {
+			return nil, err
+		}
+		if err := createRedirectListener(project, template, loadBalancerARN); err != nil {
+			return nil, err
+		}
 	}
+	return template, nil
 }
 
 func computeRollingUpdateLimits(service types.ServiceConfig) (int, int, error) {
@@ -253,6 +469,7 @@ func computeRollingUpdateLimits(service types.ServiceConfig) (int, int, error) {
 		return minPercent, maxPercent, nil
 	}
 	updateConfig := service.Deploy.UpdateConfig
+	order := updateConfig.Order
 	min, okMin := updateConfig.Extensions[compose.ExtensionMinPercent]
 	if okMin {
 		minPercent = min.(int)
@@ -272,24 +489,74 @@ func computeRollingUpdateLimits(service types.ServiceConfig) (int, int, error) {
 				fmt.Errorf("rolling update configuration require deploy.replicas to be set")
 		}
 		replicas := int(*service.Deploy.Replicas)
+		if replicas == 0 {
+			// no task to replace, keep the ECS defaults
+			return minPercent, maxPercent, nil
+		}
 		if replicas < parallelism {
 			return minPercent, maxPercent,
 				fmt.Errorf("deploy.replicas (%d) must be greater than deploy.update_config.parallelism (%d)", replicas, parallelism)
 		}
-		if !okMin {
+		// start-first keeps all tasks running while replacements start, stop-first doesn't start more tasks than
+		// replicas, and both are allowed by default
+		if !okMin && order != UpdateOrderStartFirst {
 			minPercent = (replicas - parallelism) * 100 / replicas
 		}
-		if !okMax {
+		if !okMax && order != UpdateOrderStopFirst {
 			maxPercent = (replicas + parallelism) * 100 / replicas
 		}
+	} else if order == UpdateOrderStopFirst && !okMin {
+		// compose stops a single task at a time by default
+		replicas := 1
+		if service.Deploy.Replicas != nil {
+			replicas = int(*service.Deploy.Replicas)
+		}
+		if replicas > 0 {
+			minPercent = (replicas - 1) * 100 / replicas
+		}
+	}
+	if order == UpdateOrderStopFirst && !okMax {
+		maxPercent = 100
 	}
 	return minPercent, maxPercent, nil
 }
 
+// getDeploymentCircuitBreaker maps deploy.update_config.failure_action onto the ECS deployment circuit breaker, which
+// stops a deployment when tasks fail to start, and rolls it back to the last completed deployment on rollback
+func getDeploymentCircuitBreaker(service types.ServiceConfig) (*ecs.Service_DeploymentCircuitBreaker, error) {
+	if service.Deploy == nil || service.Deploy.UpdateConfig == nil {
+		return nil, nil
+	}
+	switch action := service.Deploy.UpdateConfig.FailureAction; action {
+	case "", FailureActionContinue:
+		return nil, nil
+	case FailureActionPause:
+		return &ecs.Service_DeploymentCircuitBreaker{
+			Enable: true,
+		}, nil
+	case FailureActionRollback:
+		return &ecs.Service_DeploymentCircuitBreaker{
+			Enable:   true,
+			Rollback: true,
+		}, nil
+	default:
+		return nil, fmt.Errorf("service %s: deploy.update_config.failure_action must be one of %s, %s or %s, got %q", service.Name, FailureActionContinue, FailureActionPause, FailureActionRollback, action)
+	}
+}
+
+// publishedPort returns the port a service port is published on, which defaults to its target port
+func publishedPort(port types.ServicePortConfig) uint32 {
+	published, err := strconv.ParseUint(port.Published, 10, 16)
+	if err != nil {
+		return port.Target
+	}
+	return uint32(published)
+}
+
 func getLoadBalancerType(project *types.Project) string {
 	for _, service := range project.Services {
 		for _, port := range service.Ports {
-			if port.Published != 80 && port.Published != 443 {
+			if publishedPort(port) != 80 && publishedPort(port) != 443 {
 				return elbv2.LoadBalancerTypeEnumNetwork
 			}
 		}
@@ -297,18 +564,22 @@ func getLoadBalancerType(project *types.Project) string {
 	return elbv2.LoadBalancerTypeEnumApplication
 }
 
-func getLoadBalancerSecurityGroups(project *types.Project, template *cloudformation.Template) []string {
+func getLoadBalancerSecurityGroups(project *types.Project, template *cloudformation.Template) ([]string, error) {
 	securityGroups := []string{}
-	for _, network := range project.Networks {
+	for name, network := range project.Networks {
 		if !network.Internal {
-			net := convertNetwork(project, network, cloudformation.Ref(ParameterVPCId), template)
+			net, err := convertNetwork(project, name, network, cloudformation.Ref(ParameterVPCId), template)
+			if err != nil {
+				return nil, err
+			}
 			securityGroups = append(securityGroups, net)
 		}
 	}
-	return uniqueStrings(securityGroups)
+	sort.Strings(securityGroups)
+	return uniqueStrings(securityGroups), nil
 }
 
-func createLoadBalancer(project *types.Project, template *cloudformation.Template) string {
+func createLoadBalancer(project *types.Project, template *cloudformation.Template) (string, error) {
 	ports := 0
 	for _, service := range project.Services {
 		ports += len(service.Ports)
@@ -316,28 +587,33 @@ func createLoadBalancer(project *types.Project, template *cloudformation.Templat
 	if ports == 0 {
 		// Project do not expose any port (batch jobs?)
 		// So no need to create a LoadBalancer
-		return ""
+		return "", nil
 	}
 
-	// load balancer names are limited to 32 characters total
-	loadBalancerName := fmt.Sprintf("%.32s", fmt.Sprintf("%sLoadBalancer", strings.Title(project.Name)))
+	scheme, err := getLoadBalancerScheme(project)
+	if err != nil {
+		return "", err
+	}
+
+	loadBalancerName := getLoadBalancerName(project)
+	loadBalancer := normalizeResourceName(loadBalancerName)
 	// Create LoadBalancer if `ParameterLoadBalancerName` is not set
 	template.Conditions["CreateLoadBalancer"] = cloudformation.Equals("", cloudformation.Ref(ParameterLoadBalancerARN))
 
 	loadBalancerType := getLoadBalancerType(project)
 	securityGroups := []string{}
 	if loadBalancerType == elbv2.LoadBalancerTypeEnumApplication {
-		securityGroups = getLoadBalancerSecurityGroups(project, template)
+		securityGroups, err = getLoadBalancerSecurityGroups(project, template)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	template.Resources[loadBalancerName] = &elasticloadbalancingv2.LoadBalancer{
+	template.Resources[loadBalancer] = &elasticloadbalancingv2.LoadBalancer{
 		Name:           loadBalancerName,
-		Scheme:         elbv2.LoadBalancerSchemeEnumInternetFacing,
+		Scheme:         scheme,
 		SecurityGroups: securityGroups,
-		Subnets: []string{
-			cloudformation.Ref(ParameterSubnet1Id),
-			cloudformation.Ref(ParameterSubnet2Id),
-		},
+		Subnets:        []string{cloudformation.Ref(ParameterLoadBalancerSubnetIds)},
 		Tags: []tags.Tag{
 			{
 				Key:   compose.ProjectTag,
@@ -347,46 +623,91 @@ func createLoadBalancer(project *types.Project, template *cloudformation.Templat
 		Type:                       loadBalancerType,
 		AWSCloudFormationCondition: "CreateLoadBalancer",
 	}
-	return cloudformation.If("CreateLoadBalancer", cloudformation.Ref(loadBalancerName), cloudformation.Ref(ParameterLoadBalancerARN))
+	return cloudformation.If("CreateLoadBalancer", cloudformation.Ref(loadBalancer), cloudformation.Ref(ParameterLoadBalancerARN)), nil
 }
 
-func createListener(service types.ServiceConfig, port types.ServicePortConfig, template *cloudformation.Template, targetGroupName string, loadBalancerARN string, protocol string) string {
-	listenerName := fmt.Sprintf(
-		"%s%s%dListener",
-		normalizeResourceName(service.Name),
-		strings.ToUpper(port.Protocol),
-		port.Target,
-	)
-	//add listener to dependsOn
-	//https://stackoverflow.com/questions/53971873/the-target-group-does-not-have-an-associated-load-balancer
-	template.Resources[listenerName] = &elasticloadbalancingv2.Listener{
+var validLoadBalancerName = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9-]*$")
+
+// getLoadBalancerName returns the name of the load balancer created for a project, which is limited to 32 alphanumeric
+// characters or hyphens. Invalid or longer names get truncated with a hash of the project name, so they don't collide
+// with a project sharing the same prefix.
+func getLoadBalancerName(project *types.Project) string {
+	name := fmt.Sprintf("%sLoadBalancer", strings.Title(project.Name))
+	if len(name) <= 32 && validLoadBalancerName.MatchString(name) {
+		return name
+	}
+	return fmt.Sprintf("%.*s%s", 32-NameHashLength, fmt.Sprintf("%sLoadBalancer", normalizeResourceName(project.Name)), nameHash(project.Name))
+}
+
+// getCertificate returns the ACM certificate of the HTTPS and TLS listeners a service is published on. The certificate
+// applies to all the published ports of the service, per-port certificates aren't supported.
+func getCertificate(project *types.Project, service types.ServiceConfig) (string, error) {
+	v, ok := service.Extensions[compose.ExtensionCertificate]
+	if !ok {
+		v, ok = project.Extensions[compose.ExtensionCertificate]
+	}
+	if !ok {
+		return "", nil
+	}
+	certificate, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("service %s: %s must be an ACM certificate ARN, got %v", service.Name, compose.ExtensionCertificate, v)
+	}
+	return certificate, nil
+}
+
+// createRedirectListener adds a listener on port 80 to redirect plain HTTP requests to HTTPS, if requested by
+// x-aws-https_redirect and no service already listens on port 80
+func createRedirectListener(project *types.Project, template *cloudformation.Template, loadBalancerARN string) error {
+	v, ok := project.Extensions[compose.ExtensionHTTPSRedirect]
+	if !ok {
+		return nil
+	}
+	redirect, ok := v.(bool)
+	if !ok {
+		return fmt.Errorf("%s must be a boolean", compose.ExtensionHTTPSRedirect)
+	}
+	if !redirect {
+		return nil
+	}
+	if getLoadBalancerType(project) != elbv2.LoadBalancerTypeEnumApplication {
+		logrus.Warnf("%s is only supported by application load balancer", compose.ExtensionHTTPSRedirect)
+		return nil
+	}
+	for _, service := range project.Services {
+		for _, port := range service.Ports {
+			if publishedPort(port) == 80 {
+				logrus.Warnf("service %s already listens on port 80, HTTPS redirect is disabled", service.Name)
+				return nil
+			}
+		}
+	}
+	template.Resources["HTTPSRedirectListener"] = &elasticloadbalancingv2.Listener{
 		DefaultActions: []elasticloadbalancingv2.Listener_Action{
 			{
-				ForwardConfig: &elasticloadbalancingv2.Listener_ForwardConfig{
-					TargetGroups: []elasticloadbalancingv2.Listener_TargetGroupTuple{
-						{
-							TargetGroupArn: cloudformation.Ref(targetGroupName),
-						},
-					},
+				RedirectConfig: &elasticloadbalancingv2.Listener_RedirectConfig{
+					Port:       "443",
+					Protocol:   elbv2.ProtocolEnumHttps,
+					StatusCode: elbv2.RedirectActionStatusCodeEnumHttp301,
 				},
-				Type: elbv2.ActionTypeEnumForward,
+				Type: elbv2.ActionTypeEnumRedirect,
 			},
 		},
 		LoadBalancerArn: loadBalancerARN,
-		Protocol:        protocol,
-		Port:            int(port.Target),
+		Protocol:        elbv2.ProtocolEnumHttp,
+		Port:            80,
 	}
-	return listenerName
+	return nil
 }
 
-func createTargetGroup(project *types.Project, service types.ServiceConfig, port types.ServicePortConfig, template *cloudformation.Template, protocol string) string {
+func createTargetGroup(project *types.Project, service types.ServiceConfig, port types.ServicePortConfig, template *cloudformation.Template, protocol string, healthCheck *loadBalancerHealthCheck) string {
 	targetGroupName := fmt.Sprintf(
 		"%s%s%dTargetGroup",
-		normalizeResourceName(service.Name),
+		serviceLogicalName(project, service.Name),
 		strings.ToUpper(port.Protocol),
-		port.Published,
+		publishedPort(port),
 	)
-	template.Resources[targetGroupName] = &elasticloadbalancingv2.TargetGroup{
+	targetGroup := &elasticloadbalancingv2.TargetGroup{
 		Port:     int(port.Target),
 		Protocol: protocol,
 		Tags: []tags.Tag{
@@ -398,23 +719,22 @@ func createTargetGroup(project *types.Project, service types.ServiceConfig, port
 		VpcId:      cloudformation.Ref(ParameterVPCId),
 		TargetType: elbv2.TargetTypeEnumIp,
 	}
+	setTargetGroupHealthCheck(targetGroup, service, healthCheck, getLoadBalancerType(project))
+	template.Resources[targetGroupName] = targetGroup
 	return targetGroupName
 }
 
-func createServiceRegistry(service types.ServiceConfig, template *cloudformation.Template, healthCheck *cloudmap.Service_HealthCheckConfig) ecs.Service_ServiceRegistry {
-	serviceRegistration := fmt.Sprintf("%sServiceDiscoveryEntry", normalizeResourceName(service.Name))
+func createServiceRegistry(project *types.Project, service types.ServiceConfig, template *cloudformation.Template) ecs.Service_ServiceRegistry {
+	serviceRegistration := fmt.Sprintf("%sServiceDiscoveryEntry", serviceLogicalName(project, service.Name))
 	serviceRegistry := ecs.Service_ServiceRegistry{
 		RegistryArn: cloudformation.GetAtt(serviceRegistration, "Arn"),
 	}
 
 	template.Resources[serviceRegistration] = &cloudmap.Service{
-		Description:       fmt.Sprintf("%q service discovery entry in Cloud Map", service.Name),
-		HealthCheckConfig: healthCheck,
-		HealthCheckCustomConfig: &cloudmap.Service_HealthCheckCustomConfig{
-			FailureThreshold: 1,
-		},
-		Name:        service.Name,
-		NamespaceId: cloudformation.Ref("CloudMap"),
+		Description:             fmt.Sprintf("%q service discovery entry in Cloud Map", service.Name),
+		HealthCheckCustomConfig: getServiceRegistryHealthCheck(),
+		Name:                    service.Name,
+		NamespaceId:             cloudformation.Ref("CloudMap"),
 		DnsConfig: &cloudmap.Service_DnsConfig{
 			DnsRecords: []cloudmap.Service_DnsRecord{
 				{
@@ -428,8 +748,10 @@ func createServiceRegistry(service types.ServiceConfig, template *cloudformation
 	return serviceRegistry
 }
 
-func createTaskExecutionRole(service types.ServiceConfig, err error, definition *ecs.TaskDefinition, template *cloudformation.Template) (string, error) {
-	taskExecutionRole := fmt.Sprintf("%sTaskExecutionRole", normalizeResourceName(service.Name))
+// createTaskExecutionRole creates the role used by the ECS agent to pull images, send logs and retrieve secrets.
+// Additional permissions can be granted by x-aws-execution_role and x-aws-execution_policies
+func createTaskExecutionRole(project *types.Project, service types.ServiceConfig, containers []types.ServiceConfig, definition *ecs.TaskDefinition, template *cloudformation.Template) (string, error) {
+	taskExecutionRole := fmt.Sprintf("%sTaskExecutionRole", serviceLogicalName(project, service.Name))
 	policy, err := getPolicy(definition)
 	if err != nil {
 		return taskExecutionRole, err
@@ -441,32 +763,104 @@ func createTaskExecutionRole(service types.ServiceConfig, err error, definition
 			PolicyName:     fmt.Sprintf("%sGrantAccessToSecrets", service.Name),
 		})
 	}
-
-	if roles, ok := service.Extensions[compose.ExtensionRole]; ok {
-		rolePolicies = append(rolePolicies, iam.Role_Policy{
-			PolicyDocument: roles,
-		})
-	}
 	managedPolicies := []string{
 		ECSTaskExecutionPolicy,
 		ECRReadOnlyPolicy,
 	}
-	if v, ok := service.Extensions[compose.ExtensionManagedPolicies]; ok {
-		for _, s := range v.([]interface{}) {
-			managedPolicies = append(managedPolicies, s.(string))
-		}
-	}
+	policies, managed := getRolePolicies(project, containers, compose.ExtensionExecutionRole, compose.ExtensionExecutionPolicies)
 	template.Resources[taskExecutionRole] = &iam.Role{
 		AssumeRolePolicyDocument: assumeRolePolicyDocument,
-		Policies:                 rolePolicies,
-		ManagedPolicyArns:        managedPolicies,
+		Policies:                 append(rolePolicies, policies...),
+		ManagedPolicyArns:        append(managedPolicies, managed...),
 	}
 	return taskExecutionRole, nil
 }
 
-func createCluster(project *types.Project, template *cloudformation.Template) string {
+// createTaskRole creates the role application containers get credentials for, with permissions set by x-aws-role and
+// x-aws-policies, and those ECS Exec requires to open SSM sessions into the containers when x-aws-exec enables it.
+// Returns an empty string if the service doesn't require any permission
+func createTaskRole(project *types.Project, service types.ServiceConfig, containers []types.ServiceConfig, template *cloudformation.Template, exec bool) string {
+	for _, container := range containers {
+		_, role := container.Extensions[compose.ExtensionRole]
+		_, policies := container.Extensions[compose.ExtensionManagedPolicies]
+		if role || policies {
+			// previous versions granted these permissions to the execution role
+			logrus.Warnf("service %s: %s and %s are granted to the task role, permissions the ECS agent requires have to be set by %s and %s",
+				container.Name, compose.ExtensionRole, compose.ExtensionManagedPolicies, compose.ExtensionExecutionRole, compose.ExtensionExecutionPolicies)
+		}
+	}
+	policies, managed := getRolePolicies(project, containers, compose.ExtensionRole, compose.ExtensionManagedPolicies)
+	if exec {
+		policies = append(policies, iam.Role_Policy{
+			PolicyDocument: &PolicyDocument{
+				Version: "2012-10-17",
+				Statement: []PolicyStatement{
+					{
+						Effect: "Allow",
+						Action: []string{
+							ActionCreateControlChannel,
+							ActionCreateDataChannel,
+							ActionOpenControlChannel,
+							ActionOpenDataChannel,
+						},
+						Resource: []string{"*"},
+					},
+				},
+			},
+			PolicyName: "ECSExecPolicy",
+		})
+	}
+	if len(policies) == 0 && len(managed) == 0 {
+		return ""
+	}
+	taskRole := fmt.Sprintf("%sTaskRole", serviceLogicalName(project, service.Name))
+	template.Resources[taskRole] = &iam.Role{
+		AssumeRolePolicyDocument: assumeRolePolicyDocument,
+		Policies:                 policies,
+		ManagedPolicyArns:        managed,
+	}
+	return taskRole
+}
+
+// getRolePolicies collects the inline policies and managed policy ARNs set on containers by extensions
+func getRolePolicies(project *types.Project, containers []types.ServiceConfig, roleExtension string, policiesExtension string) ([]iam.Role_Policy, []string) {
+	policies := []iam.Role_Policy{}
+	managed := []string{}
+	for _, container := range containers {
+		if role, ok := container.Extensions[roleExtension]; ok {
+			policies = append(policies, iam.Role_Policy{
+				PolicyDocument: role,
+				PolicyName:     fmt.Sprintf("%sPolicy", serviceLogicalName(project, container.Name)),
+			})
+		}
+		if v, ok := container.Extensions[policiesExtension]; ok {
+			for _, s := range v.([]interface{}) {
+				managed = append(managed, s.(string))
+			}
+		}
+	}
+	return policies, managed
+}
+
+func createCluster(project *types.Project, template *cloudformation.Template) (string, error) {
+	strategy, err := getCapacityProviderStrategy(project.Extensions)
+	if err != nil {
+		return "", err
+	}
+	capacityProviders := []string{}
+	usesCapacityProviders := strategy != nil
+	for _, service := range project.Services {
+		if _, ok := service.Extensions[compose.ExtensionCapacityProviderStrategy]; ok {
+			usesCapacityProviders = true
+		}
+	}
+	if usesCapacityProviders {
+		capacityProviders = []string{CapacityProviderFargate, CapacityProviderFargateSpot}
+	}
 	template.Resources["Cluster"] = &ecs.Cluster{
-		ClusterName: project.Name,
+		CapacityProviders:               capacityProviders,
+		ClusterName:                     project.Name,
+		DefaultCapacityProviderStrategy: toClusterCapacityProviderStrategy(strategy),
 		Tags: []tags.Tag{
 			{
 				Key:   compose.ProjectTag,
@@ -476,7 +870,7 @@ func createCluster(project *types.Project, template *cloudformation.Template) st
 		AWSCloudFormationCondition: "CreateCluster",
 	}
 	cluster := cloudformation.If("CreateCluster", cloudformation.Ref("Cluster"), cloudformation.Ref(ParameterClusterName))
-	return cluster
+	return cluster, nil
 }
 
 func createCloudMap(project *types.Project, template *cloudformation.Template) {
@@ -487,32 +881,63 @@ func createCloudMap(project *types.Project, template *cloudformation.Template) {
 	}
 }
 
-func convertNetwork(project *types.Project, net types.NetworkConfig, vpc string, template *cloudformation.Template) string {
+func convertNetwork(project *types.Project, name string, net types.NetworkConfig, vpc string, template *cloudformation.Template) (string, error) {
 	if sg, ok := net.Extensions[compose.ExtensionSecurityGroup]; ok {
-		logrus.Debugf("Security Group for network %q set by user to %q", net.Name, sg)
-		return sg.(string)
+		logrus.Debugf("Security Group for network %q set by user to %q", name, sg)
+		return sg.(string), nil
 	}
 
 	var ingresses []ec2.SecurityGroup_Ingress
 	if !net.Internal {
 		for _, service := range project.Services {
-			if _, ok := service.Networks[net.Name]; ok {
+			// sidecar containers share the network interface and deployment of their parent service task
+			deployed := service
+			if parent := sidecarOf(service); parent != "" {
+				if p, err := project.GetService(parent); err == nil {
+					deployed = p
+				}
+			}
+			if _, ok := deployed.Networks[name]; ok {
 				for _, port := range service.Ports {
-					ingresses = append(ingresses, ec2.SecurityGroup_Ingress{
-						CidrIp:      "0.0.0.0/0",
-						Description: fmt.Sprintf("%s:%d/%s", service.Name, port.Target, port.Protocol),
-						FromPort:    int(port.Target),
-						IpProtocol:  strings.ToUpper(port.Protocol),
-						ToPort:      int(port.Target),
-					})
+					// load balancer, which shares this security group, listens on published port and forwards to target port
+					ports := []uint32{publishedPort(port)}
+					if port.Target != publishedPort(port) {
+						ports = append(ports, port.Target)
+					}
+					for _, p := range ports {
+						ingresses = append(ingresses, ec2.SecurityGroup_Ingress{
+							CidrIp:      "0.0.0.0/0",
+							Description: fmt.Sprintf("%s:%d/%s", service.Name, p, port.Protocol),
+							FromPort:    int(p),
+							IpProtocol:  strings.ToUpper(port.Protocol),
+							ToPort:      int(p),
+						})
+					}
+					if !usesBlueGreen(deployed) {
+						continue
+					}
+					test, err := getTestListener(deployed, port)
+					if err != nil {
+						return "", err
+					}
+					if test.CIDR != "" {
+						// test listener for blue/green deployments, otherwise only reachable within the network
+						ingresses = append(ingresses, ec2.SecurityGroup_Ingress{
+							CidrIp:      test.CIDR,
+							Description: fmt.Sprintf("%s:%d/%s test listener", service.Name, test.Port, port.Protocol),
+							FromPort:    test.Port,
+							IpProtocol:  strings.ToUpper(port.Protocol),
+							ToPort:      test.Port,
+						})
+					}
 				}
 			}
 		}
 	}
 
-	securityGroup := networkResourceName(project, net.Name)
+	securityGroup := networkResourceName(project, name)
 	template.Resources[securityGroup] = &ec2.SecurityGroup{
-		GroupDescription:     fmt.Sprintf("%s %s Security Group", project.Name, net.Name),
+		GroupDescription:     fmt.Sprintf("%s %s Security Group", project.Name, name),
 		GroupName:            securityGroup,
 		SecurityGroupIngress: ingresses,
 		VpcId:                vpc,
@@ -523,28 +948,28 @@ func convertNetwork(project *types.Project, net types.NetworkConfig, vpc string,
 			},
 			{
 				Key:   compose.NetworkTag,
-				Value: net.Name,
+				Value: name,
 			},
 		},
 	}
 
 	ingress := securityGroup + "Ingress"
 	template.Resources[ingress] = &ec2.SecurityGroupIngress{
-		Description:           fmt.Sprintf("Allow communication within network %s", net.Name),
+		Description:           fmt.Sprintf("Allow communication within network %s", name),
 		IpProtocol:            "-1", // all protocols
 		GroupId:               cloudformation.Ref(securityGroup),
 		SourceSecurityGroupId: cloudformation.Ref(securityGroup),
 	}
 
-	return cloudformation.Ref(securityGroup)
+	return cloudformation.Ref(securityGroup), nil
 }
 
 func networkResourceName(project *types.Project, network string) string {
-	return fmt.Sprintf("%s%sNetwork", normalizeResourceName(project.Name), normalizeResourceName(network))
+	return fmt.Sprintf("%s%sNetwork", normalizeResourceName(project.Name), networkLogicalName(project, network))
 }
 
-func serviceResourceName(dependency string) string {
-	return fmt.Sprintf("%sService", normalizeResourceName(dependency))
+func serviceResourceName(project *types.Project, service string) string {
+	return fmt.Sprintf("%sService", serviceLogicalName(project, service))
 }
 
 func normalizeResourceName(s string) string {
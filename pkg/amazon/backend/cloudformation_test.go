@@ -1,22 +1,49 @@
 package backend
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	awscloudformation "github.com/aws/aws-sdk-go/service/cloudformation"
+	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/awslabs/goformation/v4/cloudformation"
+	"github.com/awslabs/goformation/v4/cloudformation/applicationautoscaling"
+	"github.com/awslabs/goformation/v4/cloudformation/autoscaling"
 	"github.com/awslabs/goformation/v4/cloudformation/ec2"
 	"github.com/awslabs/goformation/v4/cloudformation/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation/efs"
 	"github.com/awslabs/goformation/v4/cloudformation/elasticloadbalancingv2"
+	"github.com/awslabs/goformation/v4/cloudformation/events"
 	"github.com/awslabs/goformation/v4/cloudformation/iam"
+	"github.com/awslabs/goformation/v4/cloudformation/lambda"
 	"github.com/awslabs/goformation/v4/cloudformation/logs"
+	"github.com/awslabs/goformation/v4/cloudformation/policies"
 	"github.com/compose-spec/compose-go/cli"
 	"github.com/compose-spec/compose-go/loader"
 	"github.com/compose-spec/compose-go/types"
+	cf "github.com/docker/ecs-plugin/pkg/amazon/cloudformation"
+	"github.com/docker/ecs-plugin/pkg/amazon/sdk"
+	"github.com/docker/ecs-plugin/pkg/compatibility"
 	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/docker/ecs-plugin/pkg/progress"
+	"github.com/gorilla/websocket"
 	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
 	"gotest.tools/v3/golden"
 )
 
@@ -46,6 +73,357 @@ x-aws-logs_retention: 10
 	assert.Equal(t, logGroup.RetentionInDays, 10)
 }
 
+func TestServiceLogGroup(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  foo:
+    image: hello_world
+    x-aws-logs_retention: 7
+    x-aws-logs_kms_key: arn:aws:kms:eu-west-3:123456789012:key/foo
+  bar:
+    image: hello_world
+x-aws-logs_retention: 30
+`)
+	logGroup := template.Resources["LogGroup"].(*logs.LogGroup)
+	assert.Equal(t, logGroup.LogGroupName, "/docker-compose/test")
+	assert.Equal(t, logGroup.RetentionInDays, 30)
+
+	logGroup = template.Resources["FooLogGroup"].(*logs.LogGroup)
+	assert.Equal(t, logGroup.LogGroupName, "/docker-compose/test/foo")
+	assert.Equal(t, logGroup.RetentionInDays, 7)
+	assert.Equal(t, logGroup.KmsKeyId, "arn:aws:kms:eu-west-3:123456789012:key/foo")
+
+	def := template.Resources["FooTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, def.ContainerDefinitions[0].LogConfiguration.Options["awslogs-group"], cloudformation.Ref("FooLogGroup"))
+	def = template.Resources["BarTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, def.ContainerDefinitions[0].LogConfiguration.Options["awslogs-group"], cloudformation.Ref("LogGroup"))
+
+	project := loadConfig(t, "test", `
+services:
+  foo:
+    image: hello_world
+    x-aws-logs_retention: 7
+    secrets:
+      - password
+  bar:
+    image: hello_world
+secrets:
+  password:
+    name: arn:aws:secretsmanager:eu-west-3:123456789012:secret:password
+    external: true
+`)
+	assert.Equal(t, containerLogGroup(project, "foo"), "/docker-compose/test/foo")
+	assert.Equal(t, containerLogGroup(project, "Foo_Secrets_InitContainer"), "/docker-compose/test/foo")
+	assert.Equal(t, containerLogGroup(project, "bar"), "/docker-compose/test")
+	assert.Equal(t, containerLogGroup(project, LogRouterContainerName), "/docker-compose/test")
+}
+
+func TestServiceLogGroupFromLoggingOptions(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  foo:
+    image: hello_world
+    logging:
+      options:
+        retention: "14"
+        kms_key: arn:aws:kms:eu-west-3:123456789012:key/foo
+        awslogs-datetime-pattern: FOO
+  bar:
+    image: hello_world
+    logging:
+      options:
+        retention: "14"
+    x-aws-logs_retention: 3
+`)
+	logGroup := template.Resources["FooLogGroup"].(*logs.LogGroup)
+	assert.Equal(t, logGroup.LogGroupName, "/docker-compose/test/foo")
+	assert.Equal(t, logGroup.RetentionInDays, 14)
+	assert.Equal(t, logGroup.KmsKeyId, "arn:aws:kms:eu-west-3:123456789012:key/foo")
+	def := template.Resources["FooTaskDefinition"].(*ecs.TaskDefinition)
+	assert.DeepEqual(t, def.ContainerDefinitions[0].LogConfiguration.Options, map[string]string{
+		"awslogs-region":           cloudformation.Ref("AWS::Region"),
+		"awslogs-group":            cloudformation.Ref("FooLogGroup"),
+		"awslogs-stream-prefix":    "test",
+		"awslogs-datetime-pattern": "FOO",
+	})
+
+	// extensions take precedence over logging options
+	logGroup = template.Resources["BarLogGroup"].(*logs.LogGroup)
+	assert.Equal(t, logGroup.RetentionInDays, 3)
+}
+
+func TestInvalidLogGroupSettings(t *testing.T) {
+	for _, test := range []struct {
+		yaml string
+		err  string
+	}{
+		{`
+    logging:
+      options:
+        retention: two weeks
+`, `service foo: invalid logging option retention: "two weeks" is not a number of days`},
+		{`
+    x-aws-logs_kms_key:
+      arn: arn:aws:kms:eu-west-3:123456789012:key/foo
+`, "service foo: x-aws-logs_kms_key must be the ARN or ID of a KMS key"},
+	} {
+		_, err := Backend{}.Convert(loadConfig(t, "test", `
+services:
+  foo:
+    image: hello_world`+test.yaml))
+		assert.Error(t, err, test.err)
+	}
+}
+
+func TestLogsSubscription(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  foo:
+    image: hello_world
+    x-aws-logs_subscription:
+      destination: arn:aws:lambda:eu-west-3:123456789012:function:ship
+      filter_pattern: ERROR
+x-aws-logs_subscription:
+  destination: arn:aws:kinesis:eu-west-3:123456789012:stream/logs
+  role: arn:aws:iam::123456789012:role/CWLtoKinesis
+`)
+	filter := template.Resources["LogGroupSubscriptionFilter"].(*logs.SubscriptionFilter)
+	assert.Equal(t, filter.DestinationArn, "arn:aws:kinesis:eu-west-3:123456789012:stream/logs")
+	assert.Equal(t, filter.RoleArn, "arn:aws:iam::123456789012:role/CWLtoKinesis")
+	assert.Equal(t, filter.LogGroupName, cloudformation.Ref("LogGroup"))
+
+	filter = template.Resources["FooLogGroupSubscriptionFilter"].(*logs.SubscriptionFilter)
+	assert.Equal(t, filter.FilterPattern, "ERROR")
+	assert.DeepEqual(t, filter.AWSCloudFormationDependsOn, []string{"FooLogGroupSubscriptionPermission"})
+	permission := template.Resources["FooLogGroupSubscriptionPermission"].(*lambda.Permission)
+	assert.Equal(t, permission.Principal, "logs.amazonaws.com")
+	assert.Equal(t, permission.SourceArn, cloudformation.GetAtt("FooLogGroup", "Arn"))
+
+	model := loadConfig(t, "test", `
+services:
+  foo:
+    image: hello_world
+    x-aws-logs_subscription:
+      destination: arn:aws:kinesis:eu-west-3:123456789012:stream/logs
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "service foo: x-aws-logs_subscription requires a role")
+}
+
+func TestDependsOnConditions(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  api:
+    image: api
+    x-aws-depends_on:
+      redis:
+        condition: service_healthy
+      migrate:
+        condition: service_completed_successfully
+  migrate:
+    image: migrate
+    x-aws-sidecar-of: api
+  redis:
+    image: redis
+    healthcheck:
+      test: ["CMD", "redis-cli", "ping"]
+`)
+	api := template.Resources["ApiService"].(*ecs.Service)
+	assert.Check(t, contains(api.AWSCloudFormationDependsOn, "RedisHealthy"))
+	assert.Check(t, !contains(api.AWSCloudFormationDependsOn, "RedisService"))
+
+	wait := template.Resources["RedisHealthy"].(*cloudformation.CustomResource)
+	assert.Equal(t, wait.Properties["ServiceToken"], cloudformation.GetAtt(ServiceWaitFunction, "Arn"))
+	assert.Equal(t, wait.Properties["Service"], cloudformation.Ref("RedisService"))
+	assert.Equal(t, wait.Properties["TaskDefinition"], cloudformation.Ref("RedisTaskDefinition"))
+	assert.Equal(t, wait.Properties["HealthCheck"], true)
+	function := template.Resources[ServiceWaitFunction].(*lambda.Function)
+	assert.Equal(t, function.Role, cloudformation.GetAtt(ServiceWaitFunctionRole, "Arn"))
+	assert.Check(t, strings.Contains(function.Code.ZipFile, `service.get("taskSets")`))
+
+	def := template.Resources["ApiTaskDefinition"].(*ecs.TaskDefinition)
+	assert.DeepEqual(t, def.ContainerDefinitions[0].DependsOnProp, []ecs.TaskDefinition_ContainerDependency{
+		{Condition: ecsapi.ContainerConditionSuccess, ContainerName: "migrate"},
+	})
+	assert.Equal(t, def.ContainerDefinitions[1].Name, "migrate")
+	json, err := cf.Marshall(template)
+	assert.NilError(t, err)
+	assert.Check(t, strings.Contains(string(json), `"Essential": "false"`))
+
+	for _, c := range []struct {
+		yaml     string
+		expected string
+	}{
+		{
+			yaml: `
+services:
+  api:
+    image: api
+    x-aws-depends_on:
+      redis:
+        condition: service_completed_successfully
+  redis:
+    image: redis
+`,
+			expected: "service api: service_completed_successfully can only wait for redis to complete when running in the same task",
+		},
+		{
+			yaml: `
+services:
+  api:
+    image: api
+    x-aws-depends_on:
+      redis:
+        condition: service_ready
+  redis:
+    image: redis
+`,
+			expected: `service api: unsupported condition "service_ready" on redis`,
+		},
+		{
+			yaml: `
+services:
+  api:
+    image: api
+    x-aws-depends_on:
+      cache:
+        condition: service_healthy
+  cache:
+    image: redis
+    x-aws-sidecar-of: api
+`,
+			expected: "service api: cache has no healthcheck to wait for",
+		},
+	} {
+		_, err := Backend{}.Convert(loadConfig(t, "test", c.yaml))
+		assert.ErrorContains(t, err, c.expected)
+	}
+}
+
+func TestDeterministicOutput(t *testing.T) {
+	yaml := `
+services:
+  web:
+    image: nginx
+    ports:
+      - 80:80
+    environment:
+      A: "1"
+      B: "2"
+      C: "3"
+      D: "4"
+    networks:
+      - front
+      - back
+      - admin
+    depends_on:
+      - api
+      - db
+  api:
+    image: api
+    ports:
+      - 8080:8080
+    networks:
+      - back
+  db:
+    image: postgres
+    networks:
+      - back
+networks:
+  front:
+  back:
+  admin:
+`
+	expected, err := cf.Marshall(convertYaml(t, "test", yaml))
+	assert.NilError(t, err)
+	for i := 0; i < 10; i++ {
+		actual, err := cf.Marshall(convertYaml(t, "test", yaml))
+		assert.NilError(t, err)
+		assert.Equal(t, string(actual), string(expected))
+	}
+
+	def := convertYaml(t, "test", yaml).Resources["WebTaskDefinition"].(*ecs.TaskDefinition)
+	container := def.ContainerDefinitions[0]
+	assert.DeepEqual(t, container.Environment[:4], []ecs.TaskDefinition_KeyValuePair{
+		{Name: "A", Value: "1"},
+		{Name: "B", Value: "2"},
+		{Name: "C", Value: "3"},
+		{Name: "D", Value: "4"},
+	})
+
+	sysctls := toSystemControls(types.Mapping{"net.ipv4.ip_forward": "1", "net.core.somaxconn": "1024", "kernel.shmmax": "0"})
+	assert.DeepEqual(t, []string{sysctls[0].Namespace, sysctls[1].Namespace, sysctls[2].Namespace}, []string{"kernel.shmmax", "net.core.somaxconn", "net.ipv4.ip_forward"})
+	ulimits := toUlimits(map[string]*types.UlimitsConfig{"nproc": {Soft: 1}, "nofile": {Soft: 1}, "memlock": {Soft: 1}})
+	assert.DeepEqual(t, []string{ulimits[0].Name, ulimits[1].Name, ulimits[2].Name}, []string{"memlock", "nofile", "nproc"})
+	tags := toTags(types.Labels{"team": "web", "env": "prod", "cost-center": "42"})
+	assert.DeepEqual(t, []string{tags[0].Key, tags[1].Key, tags[2].Key}, []string{"cost-center", "env", "team"})
+}
+
+func TestFirelensLogRouter(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  foo:
+    image: hello_world
+    logging:
+      driver: awsfirelens
+      options:
+        Name: datadog
+        dd_service: foo
+`)
+	def := template.Resources["FooTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, len(def.ContainerDefinitions), 2)
+	router := def.ContainerDefinitions[0]
+	assert.Equal(t, router.Name, LogRouterContainerName)
+	assert.Equal(t, router.FirelensConfiguration.Type, "fluentbit")
+	assert.Equal(t, router.LogConfiguration.LogDriver, ecsapi.LogDriverAwslogs)
+
+	foo := def.ContainerDefinitions[1]
+	assert.Equal(t, foo.LogConfiguration.LogDriver, ecsapi.LogDriverAwsfirelens)
+	assert.DeepEqual(t, foo.LogConfiguration.Options, map[string]string{"Name": "datadog", "dd_service": "foo"})
+	assert.DeepEqual(t, foo.DependsOnProp, []ecs.TaskDefinition_ContainerDependency{
+		{Condition: ecsapi.ContainerConditionStart, ContainerName: LogRouterContainerName},
+	})
+}
+
+func TestLoggingDrivers(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  foo:
+    image: hello_world
+    logging:
+      driver: splunk
+      options:
+        splunk-url: https://splunk.example.com:8088
+`)
+	def := template.Resources["FooTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, len(def.ContainerDefinitions), 1)
+	logging := def.ContainerDefinitions[0].LogConfiguration
+	assert.Equal(t, logging.LogDriver, ecsapi.LogDriverSplunk)
+	assert.DeepEqual(t, logging.Options, map[string]string{"splunk-url": "https://splunk.example.com:8088"})
+
+	model := loadConfig(t, "test", `
+services:
+  foo:
+    image: hello_world
+    logging:
+      driver: fluentd
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "fluentd logging driver is only supported on EC2 instances")
+
+	template = convertYaml(t, "test", `
+services:
+  foo:
+    image: hello_world
+    logging:
+      driver: fluentd
+x-aws-ec2:
+  instance_type: c5.large
+`)
+	def = template.Resources["FooTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, def.ContainerDefinitions[0].LogConfiguration.LogDriver, ecsapi.LogDriverFluentd)
+}
+
 func TestEnvFile(t *testing.T) {
 	template := convertYaml(t, "test", `
 services:
@@ -103,6 +481,21 @@ services:
 	assert.Check(t, service.DeploymentConfiguration.MinimumHealthyPercent == 50)
 }
 
+func TestRollingUpdateLimitsWithoutReplicas(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  foo:
+    image: hello_world
+    deploy:
+      replicas: 0
+      update_config:
+        parallelism: 0
+`)
+	service := template.Resources["FooService"].(*ecs.Service)
+	assert.Equal(t, service.DeploymentConfiguration.MaximumPercent, 200)
+	assert.Equal(t, service.DeploymentConfiguration.MinimumHealthyPercent, 100)
+}
+
 func TestRollingUpdateExtension(t *testing.T) {
 	template := convertYaml(t, "test", `
 services:
@@ -118,6 +511,118 @@ services:
 	assert.Check(t, service.DeploymentConfiguration.MinimumHealthyPercent == 25)
 }
 
+func TestRollingUpdateOrder(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  start:
+    image: hello_world
+    deploy:
+      replicas: 4
+      update_config:
+        parallelism: 2
+        order: start-first
+  stop:
+    image: hello_world
+    deploy:
+      replicas: 4
+      update_config:
+        parallelism: 1
+        order: stop-first
+  default:
+    image: hello_world
+    deploy:
+      replicas: 3
+      update_config:
+        order: stop-first
+  single:
+    image: hello_world
+    deploy:
+      update_config:
+        order: stop-first
+`)
+	service := template.Resources["StartService"].(*ecs.Service)
+	assert.Equal(t, service.DeploymentConfiguration.MinimumHealthyPercent, 100)
+	assert.Equal(t, service.DeploymentConfiguration.MaximumPercent, 150)
+	service = template.Resources["StopService"].(*ecs.Service)
+	assert.Equal(t, service.DeploymentConfiguration.MinimumHealthyPercent, 75)
+	assert.Equal(t, service.DeploymentConfiguration.MaximumPercent, 100)
+	// tasks are replaced one at a time by default
+	service = template.Resources["DefaultService"].(*ecs.Service)
+	assert.Equal(t, service.DeploymentConfiguration.MinimumHealthyPercent, 66)
+	assert.Equal(t, service.DeploymentConfiguration.MaximumPercent, 100)
+	service = template.Resources["SingleService"].(*ecs.Service)
+	assert.Equal(t, service.DeploymentConfiguration.MinimumHealthyPercent, 0)
+	assert.Equal(t, service.DeploymentConfiguration.MaximumPercent, 100)
+}
+
+func TestRollingUpdateDelayIgnored(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: hello_world
+    deploy:
+      update_config:
+        delay: 10s
+        monitor: 30s
+`)
+	checker := &FargateCompatibilityChecker{
+		compatibility.AllowList{
+			Supported: compatibleComposeAttributes,
+		},
+	}
+	compatibility.Check(model, checker)
+	errs := []string{}
+	for _, err := range checker.Errors() {
+		errs = append(errs, err.Error())
+	}
+	assert.DeepEqual(t, errs, []string{
+		"services.deploy.update_config.delay, ECS replaces the next tasks as soon as replacements are healthy: unsupported attribute",
+		"services.deploy.update_config.monitor, ECS deployment circuit breaker set by failure_action detects failed tasks instead: unsupported attribute",
+	})
+}
+
+func TestDeploymentCircuitBreaker(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  foo:
+    image: hello_world
+    deploy:
+      update_config:
+        failure_action: rollback
+  bar:
+    image: hello_world
+`)
+	service := template.Resources["FooService"].(*ecs.Service)
+	assert.DeepEqual(t, service.DeploymentConfiguration.DeploymentCircuitBreaker, &ecs.Service_DeploymentCircuitBreaker{
+		Enable:   true,
+		Rollback: true,
+	})
+	service = template.Resources["BarService"].(*ecs.Service)
+	assert.Check(t, service.DeploymentConfiguration.DeploymentCircuitBreaker == nil)
+
+	model := loadConfig(t, "test", `
+services:
+  foo:
+    image: hello_world
+    deploy:
+      update_config:
+        failure_action: retry
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "failure_action must be one of continue, pause or rollback")
+}
+
+func TestCircuitBreakerFailure(t *testing.T) {
+	assert.Check(t, isCircuitBreakerFailure(&awscloudformation.StackEvent{
+		ResourceType:         aws.String("AWS::ECS::Service"),
+		ResourceStatusReason: aws.String("Error occurred during operation 'ECS Deployment Circuit Breaker was triggered'."),
+	}))
+	assert.Check(t, !isCircuitBreakerFailure(&awscloudformation.StackEvent{
+		ResourceType:         aws.String("AWS::ECS::Service"),
+		ResourceStatusReason: aws.String("Resource timed out waiting for completion"),
+	}))
+}
+
 func TestRolePolicy(t *testing.T) {
 	template := convertYaml(t, "test", `
 services:
@@ -137,6 +642,79 @@ services:
 	assert.DeepEqual(t, []string{"secret"}, policy.Statement[0].Resource)
 }
 
+func TestTaskRole(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  foo:
+    image: hello_world
+    x-aws-policies:
+      - "arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess"
+    x-aws-role:
+      Version: "2012-10-17"
+      Statement:
+        - Effect: "Allow"
+          Action: ["dynamodb:GetItem"]
+          Resource: ["*"]
+    x-aws-execution_policies:
+      - "arn:aws:iam::aws:policy/SecretsManagerReadWrite"
+  bar:
+    image: hello_world
+`)
+	role := template.Resources["FooTaskRole"].(*iam.Role)
+	assert.DeepEqual(t, role.ManagedPolicyArns, []string{"arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess"})
+	assert.Equal(t, len(role.Policies), 1)
+	assert.Equal(t, role.Policies[0].PolicyName, "FooPolicy")
+
+	execution := template.Resources["FooTaskExecutionRole"].(*iam.Role)
+	assert.DeepEqual(t, execution.ManagedPolicyArns, []string{ECSTaskExecutionPolicy, ECRReadOnlyPolicy, "arn:aws:iam::aws:policy/SecretsManagerReadWrite"})
+	assert.Equal(t, len(execution.Policies), 0)
+
+	def := template.Resources["FooTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, def.TaskRoleArn, cloudformation.Ref("FooTaskRole"))
+
+	assert.Check(t, template.Resources["BarTaskRole"] == nil)
+	def = template.Resources["BarTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, def.TaskRoleArn, "")
+}
+
+func TestExecuteCommand(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  foo:
+    image: hello_world
+    x-aws-exec: true
+  bar:
+    image: hello_world
+`)
+	s := template.Resources["FooService"].(*ecs.Service)
+	assert.Check(t, s.EnableExecuteCommand)
+	assert.Equal(t, s.PlatformVersion, FargatePlatformVersion)
+	role := template.Resources["FooTaskRole"].(*iam.Role)
+	assert.Equal(t, len(role.Policies), 1)
+	assert.Equal(t, role.Policies[0].PolicyName, "ECSExecPolicy")
+	exec := role.Policies[0].PolicyDocument.(*PolicyDocument)
+	assert.DeepEqual(t, exec.Statement[0].Action, []string{ActionCreateControlChannel, ActionCreateDataChannel, ActionOpenControlChannel, ActionOpenDataChannel})
+
+	s = template.Resources["BarService"].(*ecs.Service)
+	assert.Check(t, !s.EnableExecuteCommand)
+	assert.Equal(t, s.PlatformVersion, "")
+	assert.Check(t, template.Resources["BarTaskRole"] == nil)
+
+	_, err := Backend{}.Convert(loadConfig(t, "test", `
+services:
+  foo:
+    image: hello_world
+    x-aws-exec: "yes"
+`))
+	assert.ErrorContains(t, err, "x-aws-exec must be a boolean")
+}
+
+func TestQuoteCommand(t *testing.T) {
+	assert.Equal(t, quoteCommand([]string{"ls", "-l", "/var/log"}), "ls -l /var/log")
+	assert.Equal(t, quoteCommand([]string{"sh", "-c", "echo $HOME && it's"}), `sh -c 'echo $HOME && it'"'"'s'`)
+	assert.Equal(t, quoteCommand([]string{"echo", ""}), "echo ''")
+}
+
 func TestMapNetworksToSecurityGroups(t *testing.T) {
 	template := convertYaml(t, "test", `
 services:
@@ -152,12 +730,14 @@ networks:
   back-tier:
     internal: true
 `)
-	assert.Check(t, template.Resources["TestPublicNetwork"] != nil)
+	assert.Check(t, template.Resources["TestFronttierNetwork"] != nil)
 	assert.Check(t, template.Resources["TestBacktierNetwork"] != nil)
 	assert.Check(t, template.Resources["TestBacktierNetworkIngress"] != nil)
-	ingress := template.Resources["TestPublicNetworkIngress"].(*ec2.SecurityGroupIngress)
+	ingress := template.Resources["TestFronttierNetworkIngress"].(*ec2.SecurityGroupIngress)
 	assert.Check(t, ingress != nil)
-	assert.Check(t, ingress.SourceSecurityGroupId == cloudformation.Ref("TestPublicNetwork"))
+	assert.Check(t, ingress.SourceSecurityGroupId == cloudformation.Ref("TestFronttierNetwork"))
+	// services only attach the networks they declare
+	assert.Check(t, template.Resources["TestDefaultNetwork"] == nil)
 
 }
 
@@ -176,35 +756,1107 @@ services:
 	assert.Check(t, len(lb.SecurityGroups) > 0)
 }
 
-func TestNoLoadBalancerIfNoPortExposed(t *testing.T) {
+func TestInternalLoadBalancer(t *testing.T) {
 	template := convertYaml(t, "test", `
 services:
   test:
     image: nginx
-  foo:
-    image: bar
+    ports:
+      - 80:80
+x-aws-loadbalancer_scheme: internal
 `)
-	for _, r := range template.Resources {
-		assert.Check(t, r.AWSCloudFormationType() != "AWS::ElasticLoadBalancingV2::TargetGroup")
-		assert.Check(t, r.AWSCloudFormationType() != "AWS::ElasticLoadBalancingV2::Listener")
-		assert.Check(t, r.AWSCloudFormationType() != "AWS::ElasticLoadBalancingV2::LoadBalancer")
-	}
+	lb := template.Resources["TestLoadBalancer"].(*elasticloadbalancingv2.LoadBalancer)
+	assert.Equal(t, lb.Scheme, elbv2.LoadBalancerSchemeEnumInternal)
+	assert.DeepEqual(t, lb.Subnets, []string{cloudformation.Ref(ParameterLoadBalancerSubnetIds)})
 }
 
-func TestServiceReplicas(t *testing.T) {
-	template := convertYaml(t, "test", `
+func TestPrivateSubnets(t *testing.T) {
+	model := loadConfig(t, "test", `
 services:
   test:
     image: nginx
-    deploy:
-      replicas: 10
+    ports:
+      - 80:80
+  public:
+    image: nginx
+    x-aws-assign_public_ip: true
+x-aws-subnets:
+  public: [subnet-pub1, subnet-pub2]
+  private: [subnet-priv1, subnet-priv2]
 `)
+	template, err := Backend{}.Convert(model)
+	assert.NilError(t, err)
 	s := template.Resources["TestService"].(*ecs.Service)
-	assert.Check(t, s != nil)
-	assert.Check(t, s.DesiredCount == 10)
+	assert.Equal(t, s.NetworkConfiguration.AwsvpcConfiguration.AssignPublicIp, "DISABLED")
+	s = template.Resources["PublicService"].(*ecs.Service)
+	assert.Equal(t, s.NetworkConfiguration.AwsvpcConfiguration.AssignPublicIp, "ENABLED")
+
+	b := Backend{api: fakeAPI{zones: map[string]string{
+		"subnet-pub1":  "eu-west-3a",
+		"subnet-pub2":  "eu-west-3b",
+		"subnet-priv1": "eu-west-3a",
+		"subnet-priv2": "eu-west-3b",
+	}}}
+	subnets, lbSubnets, err := b.GetSubNets(context.TODO(), model, "vpc")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, subnets, []string{"subnet-priv1", "subnet-priv2"})
+	assert.DeepEqual(t, lbSubnets, []string{"subnet-pub1", "subnet-pub2"})
+
+	model.Extensions["x-aws-loadbalancer_scheme"] = "internal"
+	_, lbSubnets, err = b.GetSubNets(context.TODO(), model, "vpc")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, lbSubnets, []string{"subnet-priv1", "subnet-priv2"})
+
+	model.Extensions["x-aws-loadbalancer_scheme"] = "internet-facing"
+	model.Extensions["x-aws-subnets"] = map[string]interface{}{
+		"private": []interface{}{"subnet-priv1", "subnet-priv2"},
+	}
+	_, _, err = b.GetSubNets(context.TODO(), model, "vpc")
+	assert.ErrorContains(t, err, "internet-facing load balancer requires public subnets")
 }
 
-func TestTaskSizeConvert(t *testing.T) {
+func TestSubnetsInDistinctZones(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+x-aws-subnets:
+  private: [subnet-1, subnet-2, subnet-3]
+`)
+	b := Backend{api: fakeAPI{zones: map[string]string{
+		"subnet-1": "eu-west-3a",
+		"subnet-2": "eu-west-3b",
+		"subnet-3": "eu-west-3a",
+	}}}
+	_, _, err := b.GetSubNets(context.TODO(), model, "vpc")
+	assert.ErrorContains(t, err, "x-aws-subnets declares subnets subnet-1 and subnet-3 in the same availability zone eu-west-3a")
+}
+
+func TestTargetGroupHealthCheck(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 80:80
+    healthcheck:
+      test: ["CMD", "curl", "-f", "http://localhost/health"]
+      interval: 20s
+      timeout: 30s
+      retries: 4
+      start_period: 1m
+    x-aws-healthcheck:
+      path: /health
+      matcher: 200-299
+      port: 8080
+`)
+	tg := template.Resources["TestTCP80TargetGroup"].(*elasticloadbalancingv2.TargetGroup)
+	assert.Equal(t, tg.HealthCheckPath, "/health")
+	assert.Equal(t, tg.HealthCheckProtocol, elbv2.ProtocolEnumHttp)
+	assert.Equal(t, tg.HealthCheckPort, "8080")
+	assert.Equal(t, tg.Matcher.HttpCode, "200-299")
+	assert.Equal(t, tg.HealthCheckIntervalSeconds, 20)
+	assert.Equal(t, tg.HealthCheckTimeoutSeconds, 19)
+	assert.Equal(t, tg.UnhealthyThresholdCount, 4)
+
+	s := template.Resources["TestService"].(*ecs.Service)
+	assert.Equal(t, s.HealthCheckGracePeriodSeconds, 60)
+}
+
+func TestNetworkTargetGroupHealthCheck(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: redis
+    ports:
+      - 6379:6379
+    healthcheck:
+      test: ["CMD", "redis-cli", "ping"]
+      interval: 5s
+      timeout: 3s
+      retries: 3
+`)
+	tg := template.Resources["TestTCP6379TargetGroup"].(*elasticloadbalancingv2.TargetGroup)
+	assert.Equal(t, tg.HealthCheckIntervalSeconds, 10)
+	assert.Equal(t, tg.HealthCheckTimeoutSeconds, 0)
+	assert.Equal(t, tg.HealthyThresholdCount, 3)
+	assert.Equal(t, tg.UnhealthyThresholdCount, 3)
+}
+
+func TestHTTPSListener(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 443:443
+    x-aws-certificate: "arn:aws:acm:eu-west-3:123456789012:certificate/abc"
+x-aws-https_redirect: true
+`)
+	listener := template.Resources["TestTCP443Listener"].(*elasticloadbalancingv2.Listener)
+	assert.Equal(t, listener.Protocol, elbv2.ProtocolEnumHttps)
+	assert.Equal(t, listener.Certificates[0].CertificateArn, "arn:aws:acm:eu-west-3:123456789012:certificate/abc")
+	assert.Equal(t, listener.SslPolicy, DefaultSSLPolicy)
+	tg := template.Resources["TestTCP443TargetGroup"].(*elasticloadbalancingv2.TargetGroup)
+	assert.Equal(t, tg.Protocol, elbv2.ProtocolEnumHttp)
+
+	redirect := template.Resources["HTTPSRedirectListener"].(*elasticloadbalancingv2.Listener)
+	assert.Equal(t, redirect.Port, 80)
+	assert.Equal(t, redirect.DefaultActions[0].Type, elbv2.ActionTypeEnumRedirect)
+	assert.Equal(t, redirect.DefaultActions[0].RedirectConfig.Protocol, elbv2.ProtocolEnumHttps)
+}
+
+func TestHTTPSListenerRequiresCertificate(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 443:443
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "requires x-aws-certificate")
+}
+
+func TestInvalidHTTPSRedirect(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 443:443
+    x-aws-certificate: "arn:aws:acm:eu-west-3:123456789012:certificate/abc"
+x-aws-https_redirect: "yes"
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "x-aws-https_redirect must be a boolean")
+}
+
+func TestInvalidSSLPolicy(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 443:443
+    x-aws-certificate: "arn:aws:acm:eu-west-3:123456789012:certificate/abc"
+x-aws-ssl_policy: 2016
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "x-aws-ssl_policy must be a string")
+}
+
+func TestInvalidCertificate(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 443:80
+    x-aws-certificate:
+      https: "arn:aws:acm:eu-west-3:123456789012:certificate/abc"
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "x-aws-certificate must be an ACM certificate ARN")
+}
+
+func TestDistinctPublishedPort(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 80:8080
+`)
+	listener := template.Resources["TestTCP80Listener"].(*elasticloadbalancingv2.Listener)
+	assert.Equal(t, listener.Port, 80)
+	tg := template.Resources["TestTCP80TargetGroup"].(*elasticloadbalancingv2.TargetGroup)
+	assert.Equal(t, tg.Port, 8080)
+	def := template.Resources["TestTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, def.ContainerDefinitions[0].PortMappings[0].ContainerPort, 8080)
+	assert.Equal(t, def.ContainerDefinitions[0].PortMappings[0].HostPort, 8080)
+	s := template.Resources["TestService"].(*ecs.Service)
+	assert.Equal(t, s.LoadBalancers[0].ContainerPort, 8080)
+
+	sg := template.Resources["TestDefaultNetwork"].(*ec2.SecurityGroup)
+	ports := []int{}
+	for _, ingress := range sg.SecurityGroupIngress {
+		ports = append(ports, ingress.FromPort)
+	}
+	assert.DeepEqual(t, ports, []int{80, 8080})
+
+	// published port ranges can't be listened on by a load balancer
+	_, err := Backend{}.Convert(loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 8000-8001:80
+`))
+	assert.ErrorContains(t, err, "compose file is incompatible with Amazon ECS")
+}
+
+func TestRoutingRules(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  front:
+    image: nginx
+    ports:
+      - 443:80
+    x-aws-certificate: "arn:aws:acm:eu-west-3:123456789012:certificate/abc"
+  api:
+    image: api
+    ports:
+      - 443:8080
+    x-aws-certificate: "arn:aws:acm:eu-west-3:123456789012:certificate/def"
+    x-aws-routing:
+      paths:
+        - /api/*
+  admin:
+    image: admin
+    ports:
+      - 443:8081
+    x-aws-routing:
+      hosts:
+        - admin.example.com
+      priority: 1
+`)
+	listener := template.Resources["HTTPS443Listener"].(*elasticloadbalancingv2.Listener)
+	assert.Equal(t, listener.DefaultActions[0].ForwardConfig.TargetGroups[0].TargetGroupArn, cloudformation.Ref("FrontTCP443TargetGroup"))
+	certificates := template.Resources["HTTPS443ListenerCertificates"].(*elasticloadbalancingv2.ListenerCertificate)
+	assert.Equal(t, len(certificates.Certificates), 1)
+
+	api := template.Resources["ApiHTTPS443ListenerRule"].(*elasticloadbalancingv2.ListenerRule)
+	assert.Equal(t, api.ListenerArn, cloudformation.Ref("HTTPS443Listener"))
+	assert.Equal(t, api.Priority, 2)
+	assert.Equal(t, api.Conditions[0].Field, "path-pattern")
+	assert.DeepEqual(t, api.Conditions[0].PathPatternConfig.Values, []string{"/api/*"})
+	assert.Equal(t, api.Actions[0].ForwardConfig.TargetGroups[0].TargetGroupArn, cloudformation.Ref("ApiTCP443TargetGroup"))
+
+	admin := template.Resources["AdminHTTPS443ListenerRule"].(*elasticloadbalancingv2.ListenerRule)
+	assert.Equal(t, admin.Priority, 1)
+	assert.Equal(t, admin.Conditions[0].Field, "host-header")
+
+	s := template.Resources["ApiService"].(*ecs.Service)
+	assert.Check(t, contains(s.AWSCloudFormationDependsOn, "ApiHTTPS443ListenerRule"))
+}
+
+func TestRoutingWithoutDefaultService(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  api:
+    image: api
+    ports:
+      - 80:8080
+    x-aws-routing:
+      paths:
+        - /api/*
+`)
+	listener := template.Resources["ApiTCP80Listener"].(*elasticloadbalancingv2.Listener)
+	assert.Equal(t, listener.DefaultActions[0].Type, elbv2.ActionTypeEnumFixedResponse)
+}
+
+func TestRoutingConflicts(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  front:
+    image: nginx
+    ports:
+      - 80:80
+  back:
+    image: nginx
+    ports:
+      - 80:8080
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "both publish port 80 without x-aws-routing")
+
+	model = loadConfig(t, "test", `
+services:
+  front:
+    image: nginx
+    ports:
+      - 80:80
+    x-aws-routing:
+      paths: [/front]
+      priority: 3
+  back:
+    image: nginx
+    ports:
+      - 80:8080
+    x-aws-routing:
+      paths: [/back]
+      priority: 3
+`)
+	_, err = Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "same x-aws-routing priority 3")
+
+	model = loadConfig(t, "test", `
+services:
+  front:
+    image: nginx
+    ports:
+      - 80:80
+    x-aws-routing:
+      paths: [/front]
+      priority: 50001
+`)
+	_, err = Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "priority must be 0 (automatic) or between 1 and 50000, got 50001")
+}
+
+func TestListenerRuleNameConflict(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  api:
+    image: api
+    ports:
+      - 80:8080
+    x-aws-routing:
+      paths: [/api]
+`)
+	l := listeners{}
+	_, err := l.add(model, model.Services[0], model.Services[0].Ports[0], elbv2.ProtocolEnumHttp, "", "ApiTCP80TargetGroup", &routing{Paths: []string{"/api"}})
+	assert.NilError(t, err)
+	template := cloudformation.NewTemplate()
+	template.Resources["ApiHTTP80ListenerRule"] = &ecs.Service{}
+	err = l.createListeners(model, template, "arn")
+	assert.ErrorContains(t, err, "resource ApiHTTP80ListenerRule can't be created, its CloudFormation logical ID is already used")
+}
+
+func TestNoLoadBalancerIfNoPortExposed(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+  foo:
+    image: bar
+`)
+	for _, r := range template.Resources {
+		assert.Check(t, r.AWSCloudFormationType() != "AWS::ElasticLoadBalancingV2::TargetGroup")
+		assert.Check(t, r.AWSCloudFormationType() != "AWS::ElasticLoadBalancingV2::Listener")
+		assert.Check(t, r.AWSCloudFormationType() != "AWS::ElasticLoadBalancingV2::LoadBalancer")
+	}
+}
+
+func TestServiceReplicas(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    deploy:
+      replicas: 10
+`)
+	s := template.Resources["TestService"].(*ecs.Service)
+	assert.Check(t, s != nil)
+	assert.Check(t, s.DesiredCount == 10)
+}
+
+func TestAutoScaling(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 80:80
+    deploy:
+      x-aws-autoscaling:
+        min: 2
+        max: 10
+        cpu: 75
+        requests: 1000
+`)
+	s := template.Resources["TestService"].(*ecs.Service)
+	assert.Equal(t, s.DesiredCount, 2)
+	target := template.Resources["TestScalableTarget"].(*applicationautoscaling.ScalableTarget)
+	assert.Equal(t, target.MinCapacity, 2)
+	assert.Equal(t, target.MaxCapacity, 10)
+	assert.Equal(t, target.RoleARN, cloudformation.GetAtt(AutoScalingRole, "Arn"))
+	cpu := template.Resources["TestCPUScalingPolicy"].(*applicationautoscaling.ScalingPolicy)
+	assert.Equal(t, cpu.ScalingTargetId, cloudformation.Ref("TestScalableTarget"))
+	assert.Equal(t, cpu.TargetTrackingScalingPolicyConfiguration.TargetValue, float64(75))
+	requests := template.Resources["TestRequestsScalingPolicy"].(*applicationautoscaling.ScalingPolicy)
+	assert.Equal(t, requests.TargetTrackingScalingPolicyConfiguration.PredefinedMetricSpecification.PredefinedMetricType, "ALBRequestCountPerTarget")
+	_, ok := template.Resources["TestMemoryScalingPolicy"]
+	assert.Check(t, !ok)
+	_, ok = template.Resources[AutoScalingRole]
+	assert.Check(t, ok)
+}
+
+func TestAutoScalingKeepsDeployedDesiredCount(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    deploy:
+      replicas: 4
+      x-aws-autoscaling:
+        min: 1
+        max: 10
+        cpu: 75
+  worker:
+    image: worker
+    deploy:
+      replicas: 3
+      x-aws-autoscaling:
+        min: 2
+        max: 10
+        cpu: 75
+  static:
+    image: nginx
+    deploy:
+      replicas: 5
+`)
+	template, err := Backend{}.Convert(model)
+	assert.NilError(t, err)
+	assert.Equal(t, template.Resources["TestService"].(*ecs.Service).DesiredCount, 1)
+
+	// worker isn't deployed yet
+	err = keepScaledDesiredCounts(model, template, map[string]string{
+		"TestService":   "arn:aws:ecs:eu-west-3:123456789012:service/test",
+		"StaticService": "arn:aws:ecs:eu-west-3:123456789012:service/static",
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, template.Resources["TestService"].(*ecs.Service).DesiredCount, 0)
+	assert.Equal(t, template.Resources["WorkerService"].(*ecs.Service).DesiredCount, 2)
+	assert.Equal(t, template.Resources["StaticService"].(*ecs.Service).DesiredCount, 5)
+}
+
+func TestAutoScalingRequestsRequiresLoadBalancer(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    deploy:
+      x-aws-autoscaling:
+        max: 10
+        requests: 1000
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "requires the service to be exposed by an application load balancer")
+}
+
+func TestCapacityProviderStrategy(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  web:
+    image: nginx
+  worker:
+    image: worker
+    x-aws-capacity_provider_strategy:
+      - capacity_provider: FARGATE_SPOT
+        weight: 1
+x-aws-capacity_provider_strategy:
+  - capacity_provider: FARGATE
+    base: 1
+    weight: 1
+  - capacity_provider: FARGATE_SPOT
+    weight: 3
+`)
+	cluster := template.Resources["Cluster"].(*ecs.Cluster)
+	assert.DeepEqual(t, cluster.CapacityProviders, []string{CapacityProviderFargate, CapacityProviderFargateSpot})
+	assert.Equal(t, len(cluster.DefaultCapacityProviderStrategy), 2)
+	assert.Equal(t, cluster.DefaultCapacityProviderStrategy[0].Base, 1)
+
+	web := template.Resources["WebService"].(*ecs.Service)
+	assert.Equal(t, web.LaunchType, "")
+	assert.Equal(t, len(web.CapacityProviderStrategy), 2)
+	assert.Equal(t, web.CapacityProviderStrategy[1].Weight, 3)
+
+	worker := template.Resources["WorkerService"].(*ecs.Service)
+	assert.Equal(t, worker.LaunchType, "")
+	assert.DeepEqual(t, worker.CapacityProviderStrategy, []ecs.Service_CapacityProviderStrategyItem{
+		{CapacityProvider: CapacityProviderFargateSpot, Weight: 1},
+	})
+}
+
+func TestInvalidCapacityProvider(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    x-aws-capacity_provider_strategy:
+      - capacity_provider: EC2
+        weight: 1
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "unsupported capacity provider")
+}
+
+func TestLinuxParameters(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    shm_size: 1gb
+    tmpfs:
+      - /run
+      - /tmp:rw,noexec,size=512m
+    volumes:
+      - type: tmpfs
+        target: /cache
+        tmpfs:
+          size: 2000000000
+    devices:
+      - /dev/fuse
+      - /dev/sda:/dev/xvda:rw
+x-aws-ec2:
+  instance_type: c5.large
+`)
+	def := template.Resources["TestTaskDefinition"].(*ecs.TaskDefinition)
+	linux := def.ContainerDefinitions[0].LinuxParameters
+	assert.Equal(t, linux.SharedMemorySize, 1024)
+	assert.DeepEqual(t, linux.Tmpfs, []ecs.TaskDefinition_Tmpfs{
+		{ContainerPath: "/run", Size: DefaultTmpfsSize},
+		{ContainerPath: "/tmp", Size: 512, MountOptions: []string{"rw", "noexec"}},
+		{ContainerPath: "/cache", Size: 1908},
+	})
+	assert.DeepEqual(t, linux.Devices, []ecs.TaskDefinition_Device{
+		{HostPath: "/dev/fuse", ContainerPath: "/dev/fuse"},
+		{HostPath: "/dev/sda", ContainerPath: "/dev/xvda", Permissions: []string{"read", "write"}},
+	})
+	assert.Equal(t, len(def.Volumes), 0)
+}
+
+func TestLinuxParametersRequireEC2(t *testing.T) {
+	for _, yaml := range []string{`
+services:
+  test:
+    image: nginx
+    shm_size: 1gb
+`, `
+services:
+  test:
+    image: nginx
+    tmpfs: /run
+`, `
+services:
+  test:
+    image: nginx
+    volumes:
+      - type: tmpfs
+        target: /cache
+`, `
+services:
+  test:
+    image: nginx
+    devices:
+      - /dev/fuse
+`} {
+		model := loadConfig(t, "test", yaml)
+		_, err := Backend{}.Convert(model)
+		assert.ErrorContains(t, err, "compose file is incompatible with Amazon ECS")
+	}
+}
+
+func TestGPUReservation(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  inference:
+    image: tensorflow/serving:latest-gpu
+    deploy:
+      resources:
+        reservations:
+          generic_resources:
+            - discrete_resource_spec:
+                kind: gpu
+                value: 2
+x-aws-ec2:
+  instance_type: g4dn.12xlarge
+`)
+	def := template.Resources["InferenceTaskDefinition"].(*ecs.TaskDefinition)
+	assert.DeepEqual(t, def.ContainerDefinitions[0].ResourceRequirements, []ecs.TaskDefinition_ResourceRequirement{
+		{Type: ecsapi.ResourceTypeGpu, Value: "2"},
+	})
+	assert.Equal(t, template.Parameters[ParameterEC2InstanceAMI].Default, ECSOptimizedGPUAMI)
+
+	// other generic resources are ignored, but left in the project
+	model := loadConfig(t, "test", `
+services:
+  inference:
+    image: tensorflow/serving:latest-gpu
+    deploy:
+      resources:
+        reservations:
+          generic_resources:
+            - discrete_resource_spec:
+                kind: ssd
+                value: 1
+            - discrete_resource_spec:
+                kind: gpu
+                value: 1
+x-aws-ec2:
+  instance_type: g4dn.xlarge
+`)
+	template, err := Backend{}.Convert(model)
+	assert.NilError(t, err)
+	def = template.Resources["InferenceTaskDefinition"].(*ecs.TaskDefinition)
+	assert.DeepEqual(t, def.ContainerDefinitions[0].ResourceRequirements, []ecs.TaskDefinition_ResourceRequirement{
+		{Type: ecsapi.ResourceTypeGpu, Value: "1"},
+	})
+	assert.Equal(t, len(model.Services[0].Deploy.Resources.Reservations.GenericResources), 2)
+
+	for instanceType, expected := range map[string]string{
+		"c5.large":    "service inference reserves 2 GPUs, but c5.large instances have none",
+		"g4dn.xlarge": "service inference reserves 2 GPUs, but g4dn.xlarge instances only have 1",
+	} {
+		model := loadConfig(t, "test", fmt.Sprintf(`
+services:
+  inference:
+    image: tensorflow/serving:latest-gpu
+    deploy:
+      resources:
+        reservations:
+          generic_resources:
+            - discrete_resource_spec:
+                kind: gpu
+                value: 2
+x-aws-ec2:
+  instance_type: %s
+`, instanceType))
+		_, err := Backend{}.Convert(model)
+		assert.Error(t, err, expected)
+	}
+
+	model = loadConfig(t, "test", `
+services:
+  inference:
+    image: tensorflow/serving:latest-gpu
+    deploy:
+      resources:
+        reservations:
+          generic_resources:
+            - discrete_resource_spec:
+                kind: gpu
+                value: 1
+`)
+	_, err = Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "compose file is incompatible with Amazon ECS")
+}
+
+func TestGPUDeviceReservation(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  inference:
+    image: tensorflow/serving:latest-gpu
+    deploy:
+      resources:
+        reservations:
+          devices:
+            - capabilities: [gpu]
+              count: 2
+            - capabilities: [tpu]
+              count: 1
+  training:
+    image: tensorflow/tensorflow:latest-gpu
+    deploy:
+      resources:
+        reservations:
+          devices:
+            - capabilities: [gpu]
+              device_ids: ["0", "1", "2"]
+x-aws-ec2:
+  instance_type: g4dn.12xlarge
+`)
+	def := template.Resources["InferenceTaskDefinition"].(*ecs.TaskDefinition)
+	assert.DeepEqual(t, def.ContainerDefinitions[0].ResourceRequirements, []ecs.TaskDefinition_ResourceRequirement{
+		{Type: ecsapi.ResourceTypeGpu, Value: "2"},
+	})
+	def = template.Resources["TrainingTaskDefinition"].(*ecs.TaskDefinition)
+	assert.DeepEqual(t, def.ContainerDefinitions[0].ResourceRequirements, []ecs.TaskDefinition_ResourceRequirement{
+		{Type: ecsapi.ResourceTypeGpu, Value: "3"},
+	})
+	assert.Equal(t, template.Parameters[ParameterEC2InstanceAMI].Default, ECSOptimizedGPUAMI)
+
+	for _, yaml := range []string{`
+services:
+  inference:
+    image: tensorflow/serving:latest-gpu
+    deploy:
+      resources:
+        reservations:
+          devices:
+            - capabilities: [gpu]
+              count: all
+x-aws-ec2:
+  instance_type: g4dn.12xlarge
+`, `
+services:
+  inference:
+    image: tensorflow/serving:latest-gpu
+    deploy:
+      resources:
+        reservations:
+          devices:
+            - capabilities: [gpu]
+              count: 1
+`} {
+		_, err := Backend{}.Convert(loadConfig(t, "test", yaml))
+		assert.ErrorContains(t, err, "compose file is incompatible with Amazon ECS")
+	}
+}
+
+func TestEC2Instances(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    deploy:
+      placement:
+        constraints:
+          - attribute:ecs.instance-type =~ c5.*
+        preferences:
+          - spread: attribute:ecs.availability-zone
+x-aws-ec2:
+  instance_type: c5.large
+  count: 2
+  max: 4
+`)
+	def := template.Resources["TestTaskDefinition"].(*ecs.TaskDefinition)
+	assert.DeepEqual(t, def.RequiresCompatibilities, []string{"EC2"})
+	assert.DeepEqual(t, def.PlacementConstraints, []ecs.TaskDefinition_TaskDefinitionPlacementConstraint{
+		{Expression: "attribute:ecs.instance-type =~ c5.*", Type: "memberOf"},
+	})
+
+	s := template.Resources["TestService"].(*ecs.Service)
+	assert.Equal(t, s.LaunchType, "")
+	assert.Equal(t, s.CapacityProviderStrategy[0].CapacityProvider, cloudformation.Ref(EC2CapacityProvider))
+	assert.Check(t, contains(s.AWSCloudFormationDependsOn, EC2CapacityProviderAssociation))
+	assert.DeepEqual(t, s.PlacementStrategies, []ecs.Service_PlacementStrategy{
+		{Field: "attribute:ecs.availability-zone", Type: "spread"},
+	})
+
+	asg := template.Resources["EC2AutoScalingGroup"].(*autoscaling.AutoScalingGroup)
+	assert.Equal(t, asg.MinSize, "2")
+	assert.Equal(t, asg.MaxSize, "4")
+	assert.Equal(t, template.Parameters[ParameterEC2InstanceAMI].Default, ECSOptimizedAMI)
+	_, ok := template.Resources[EC2CapacityProvider].(*ecs.CapacityProvider)
+	assert.Check(t, ok)
+	association := template.Resources[EC2CapacityProviderAssociation].(*ecs.ClusterCapacityProviderAssociations)
+	assert.Equal(t, association.AWSCloudFormationCondition, "CreateCluster")
+}
+
+func TestEC2InstancesOnExistingCluster(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+x-aws-cluster: shared
+x-aws-ec2:
+  instance_type: c5.large
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "x-aws-ec2 can't be used with x-aws-cluster")
+}
+
+func TestPlacementExpressions(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    deploy:
+      placement:
+        constraints:
+          - node.labels.zone == eu-west-3a
+          - node.platform.os!=windows
+          - node.platform.arch == aarch64
+        preferences:
+          - spread: node.labels.rack
+          - spread: instanceId
+x-aws-ec2:
+  instance_type: c5.large
+`)
+	def := template.Resources["TestTaskDefinition"].(*ecs.TaskDefinition)
+	assert.DeepEqual(t, def.PlacementConstraints, []ecs.TaskDefinition_TaskDefinitionPlacementConstraint{
+		{Expression: "attribute:zone == eu-west-3a", Type: "memberOf"},
+		{Expression: "attribute:ecs.os-type != windows", Type: "memberOf"},
+		{Expression: "attribute:ecs.cpu-architecture == arm64", Type: "memberOf"},
+	})
+	s := template.Resources["TestService"].(*ecs.Service)
+	assert.DeepEqual(t, s.PlacementStrategies, []ecs.Service_PlacementStrategy{
+		{Field: "attribute:rack", Type: "spread"},
+		{Field: "instanceId", Type: "spread"},
+	})
+}
+
+func TestUnsupportedPlacement(t *testing.T) {
+	for _, placement := range []string{
+		"constraints: [node.role == manager]",
+		"constraints: [node.hostname == node1]",
+		"preferences: [{spread: node.role}]",
+	} {
+		model := loadConfig(t, "test", fmt.Sprintf(`
+services:
+  test:
+    image: nginx
+    deploy:
+      placement:
+        %s
+x-aws-ec2:
+  instance_type: c5.large
+`, placement))
+		_, err := Backend{}.Convert(model)
+		assert.ErrorContains(t, err, "incompatible", placement)
+	}
+}
+
+func TestPlacementIgnoredOnFargate(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    deploy:
+      placement:
+        constraints:
+          - attribute:ecs.instance-type =~ c5.*
+`)
+	def := template.Resources["TestTaskDefinition"].(*ecs.TaskDefinition)
+	assert.DeepEqual(t, def.RequiresCompatibilities, []string{"FARGATE"})
+	assert.Check(t, def.PlacementConstraints == nil)
+}
+
+func TestSidecars(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  app:
+    image: app
+    deploy:
+      resources:
+        limits:
+          cpus: '0.5'
+          memory: 1024M
+  proxy:
+    image: nginx
+    network_mode: service:app
+    depends_on:
+      - app
+    ports:
+      - 80:80
+    deploy:
+      resources:
+        limits:
+          cpus: '0.5'
+          memory: 1024M
+  agent:
+    image: agent
+    x-aws-sidecar-of: app
+  db:
+    image: postgres
+  worker:
+    image: worker
+    depends_on:
+      - proxy
+`)
+	_, ok := template.Resources["ProxyService"]
+	assert.Check(t, !ok)
+	_, ok = template.Resources["AgentTaskDefinition"]
+	assert.Check(t, !ok)
+
+	def := template.Resources["AppTaskDefinition"].(*ecs.TaskDefinition)
+	names := []string{}
+	for _, c := range def.ContainerDefinitions {
+		names = append(names, c.Name)
+	}
+	assert.DeepEqual(t, names, []string{"app", "agent", "proxy"})
+	assert.DeepEqual(t, def.ContainerDefinitions[2].DependsOnProp, []ecs.TaskDefinition_ContainerDependency{
+		{Condition: "START", ContainerName: "app"},
+	})
+	assert.Equal(t, def.Cpu, "1024")
+	assert.Equal(t, def.Memory, "2048")
+
+	s := template.Resources["AppService"].(*ecs.Service)
+	assert.Equal(t, s.LoadBalancers[0].ContainerName, "proxy")
+	assert.Equal(t, s.LoadBalancers[0].TargetGroupArn, cloudformation.Ref("ProxyTCP80TargetGroup"))
+	assert.Check(t, !contains(s.AWSCloudFormationDependsOn, "AppService"))
+
+	worker := template.Resources["WorkerService"].(*ecs.Service)
+	assert.DeepEqual(t, worker.AWSCloudFormationDependsOn, []string{"AppService"})
+}
+
+func TestNestedSidecars(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  app:
+    image: app
+  proxy:
+    image: nginx
+    network_mode: service:app
+  agent:
+    image: agent
+    x-aws-sidecar-of: proxy
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "which is a sidecar itself")
+}
+
+func TestBlueGreenDeployment(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 80:80
+    x-aws-deployment: blue_green
+`)
+	s := template.Resources["TestService"].(*ecs.Service)
+	assert.Equal(t, s.DeploymentController.Type, ecsapi.DeploymentControllerTypeCodeDeploy)
+	assert.Equal(t, s.TaskDefinition, cloudformation.If("TestInitialTaskDefinition", cloudformation.Ref("TestTaskDefinition"), cloudformation.Ref("ParameterTestTaskDefinition")))
+	_, ok := template.Parameters["ParameterTestTaskDefinition"]
+	assert.Check(t, ok)
+
+	_, ok = template.Resources["TestTCP80GreenTargetGroup"].(*elasticloadbalancingv2.TargetGroup)
+	assert.Check(t, ok)
+	testListener := template.Resources["HTTP10080Listener"].(*elasticloadbalancingv2.Listener)
+	assert.Equal(t, testListener.Port, 10080)
+	assert.Equal(t, testListener.DefaultActions[0].ForwardConfig.TargetGroups[0].TargetGroupArn, cloudformation.Ref("TestTCP80GreenTargetGroup"))
+
+	group := template.Resources["TestDeploymentGroup"].(*deploymentGroup)
+	assert.Equal(t, group.ApplicationName, cloudformation.Ref(CodeDeployApplication))
+	assert.Equal(t, group.ServiceRoleArn, cloudformation.GetAtt(CodeDeployRole, "Arn"))
+	assert.Equal(t, group.ECSServices[0].ServiceName, cloudformation.GetAtt("TestService", "Name"))
+	pair := group.LoadBalancerInfo.TargetGroupPairInfoList[0]
+	assert.DeepEqual(t, pair.ProdTrafficRoute.ListenerArns, []string{cloudformation.Ref("TestTCP80Listener")})
+	assert.DeepEqual(t, pair.TestTrafficRoute.ListenerArns, []string{cloudformation.Ref("HTTP10080Listener")})
+	// test listener is only reachable within the network by default
+	sg := template.Resources["TestDefaultNetwork"].(*ec2.SecurityGroup)
+	for _, ingress := range sg.SecurityGroupIngress {
+		assert.Check(t, ingress.FromPort != 10080)
+	}
+	assert.Equal(t, len(pair.TargetGroups), 2)
+	assert.Check(t, group.AutoRollbackConfiguration.Enabled)
+
+	json, err := cf.Marshall(template)
+	assert.NilError(t, err)
+	assert.Check(t, strings.Contains(string(json), `"Type": "AWS::CodeDeploy::DeploymentGroup"`))
+}
+
+func TestBlueGreenTestListener(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 80:80
+    x-aws-deployment: blue_green
+    x-aws-test_listener:
+      port: 8080
+      cidr: 203.0.113.0/24
+`)
+	testListener := template.Resources["HTTP8080Listener"].(*elasticloadbalancingv2.Listener)
+	assert.Equal(t, testListener.Port, 8080)
+	sg := template.Resources["TestDefaultNetwork"].(*ec2.SecurityGroup)
+	ingress := sg.SecurityGroupIngress[len(sg.SecurityGroupIngress)-1]
+	assert.Equal(t, ingress.FromPort, 8080)
+	assert.Equal(t, ingress.CidrIp, "203.0.113.0/24")
+
+	for _, tc := range []struct {
+		extension string
+		err       string
+	}{
+		{"", "test listener port 70000 must be between 1 and 65535"},
+		{"x-aws-test_listener: {port: 60000}", "test listener port must differ from published port 60000"},
+		{"x-aws-test_listener: {port: 8080, cidr: everywhere}", "invalid x-aws-test_listener cidr"},
+	} {
+		model := loadConfig(t, "test", fmt.Sprintf(`
+services:
+  test:
+    image: nginx
+    ports:
+      - 60000:80
+    x-aws-deployment: blue_green
+    %s
+`, tc.extension))
+		_, err := Backend{}.Convert(model)
+		assert.ErrorContains(t, err, tc.err)
+	}
+}
+
+func TestBlueGreenDeploymentRequiresSinglePort(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 80:80
+      - 443:443
+    x-aws-deployment: blue_green
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "blue_green deployment only supports a single published port")
+
+	model = loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    x-aws-deployment: blue_green
+`)
+	_, err = Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "blue_green deployment requires a published port")
+}
+
+func TestAppSpec(t *testing.T) {
+	spec, err := getAppSpec("arn:task", ecs.Service_LoadBalancer{
+		ContainerName: "test",
+		ContainerPort: 80,
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, spec, `{"Resources":[{"TargetService":{"Properties":{"LoadBalancerInfo":{"ContainerName":"test","ContainerPort":80},"TaskDefinition":"arn:task"},"Type":"AWS::ECS::Service"}}],"version":0.0}`)
+}
+
+func TestScheduledTask(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  report:
+    image: report
+    x-aws-schedule: "cron(0 3 * * ? *)"
+  web:
+    image: nginx
+    depends_on:
+      - report
+`)
+	_, ok := template.Resources["ReportService"]
+	assert.Check(t, !ok)
+	_, ok = template.Resources["ReportServiceDiscoveryEntry"]
+	assert.Check(t, !ok)
+	web := template.Resources["WebService"].(*ecs.Service)
+	assert.Equal(t, len(web.AWSCloudFormationDependsOn), 0)
+
+	rule := template.Resources["ReportSchedule"].(*events.Rule)
+	assert.Equal(t, rule.ScheduleExpression, "cron(0 3 * * ? *)")
+	target := rule.Targets[0]
+	assert.Equal(t, target.RoleArn, cloudformation.GetAtt(EventsRole, "Arn"))
+	assert.Equal(t, target.EcsParameters.TaskDefinitionArn, cloudformation.Ref("ReportTaskDefinition"))
+	assert.Equal(t, target.EcsParameters.LaunchType, ecsapi.LaunchTypeFargate)
+	assert.DeepEqual(t, target.EcsParameters.NetworkConfiguration.AwsVpcConfiguration.Subnets, []string{cloudformation.Ref(ParameterSubnetIds)})
+	assert.DeepEqual(t, target.EcsParameters.NetworkConfiguration.AwsVpcConfiguration.SecurityGroups, []string{cloudformation.Ref("TestDefaultNetwork")})
+
+	role := template.Resources[EventsRole].(*iam.Role)
+	assert.DeepEqual(t, role.ManagedPolicyArns, []string{ECSEventsPolicy})
+}
+
+func TestInvalidSchedule(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  report:
+    image: report
+    x-aws-schedule: "every day"
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "x-aws-schedule must be a cron(...) or rate(...) expression")
+
+	model = loadConfig(t, "test", `
+services:
+  report:
+    image: report
+    ports:
+      - 80:80
+    x-aws-schedule: "rate(1 hour)"
+`)
+	_, err = Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "scheduled tasks can't publish ports")
+}
+
+func TestTaskSizeConvert(t *testing.T) {
 	template := convertYaml(t, "test", `
 services:
   test:
@@ -239,6 +1891,29 @@ services:
 	assert.Equal(t, def.Cpu, "4096")
 	assert.Equal(t, def.Memory, "8192")
 }
+func TestTaskSizeWithSidecars(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    deploy:
+      resources:
+        limits:
+          cpus: '0.5'
+          memory: 1024M
+  proxy:
+    image: envoy
+    x-aws-sidecar-of: test
+    deploy:
+      resources:
+        limits:
+          memory: 2048M
+`)
+	def := template.Resources["TestTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, def.Cpu, "512")
+	assert.Equal(t, def.Memory, "3072")
+}
+
 func TestTaskSizeConvertFailure(t *testing.T) {
 	model := loadConfig(t, "test", `
 services:
@@ -298,6 +1973,228 @@ services:
 	assert.Equal(t, container.WorkingDirectory, "working_dir")
 }
 
+func TestVolumes(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: postgres
+    volumes:
+      - db-data:/var/lib/postgresql/data
+volumes:
+  db-data:
+    driver_opts:
+      uid: 999
+      gid: 999
+      root_directory: /data
+`)
+	template, err := Backend{}.Convert(model)
+	assert.NilError(t, err)
+	fs := template.Resources["DbdataFilesystem"].(*efs.FileSystem)
+	assert.Check(t, fs.Encrypted)
+	// volume data outlives the stack
+	assert.Equal(t, fs.AWSCloudFormationDeletionPolicy, policies.DeletionPolicy("Retain"))
+	assert.Equal(t, fs.AWSCloudFormationCondition, "CreateDbdataFilesystem")
+	assert.DeepEqual(t, fs.FileSystemTags, []efs.FileSystem_ElasticFileSystemTag{
+		{Key: compose.ProjectTag, Value: "test"},
+		{Key: compose.VolumeTag, Value: "db-data"},
+	})
+	assert.Equal(t, template.Parameters["ParameterDbdataFilesystem"].Default, "")
+	fileSystem := cloudformation.If("CreateDbdataFilesystem", cloudformation.Ref("DbdataFilesystem"), cloudformation.Ref("ParameterDbdataFilesystem"))
+	for i, name := range []string{"DbdataNFSMountTargetOnSubnet1", "DbdataNFSMountTargetOnSubnet2"} {
+		m := template.Resources[name].(*efs.MountTarget)
+		assert.Equal(t, m.FileSystemId, fileSystem)
+		assert.Equal(t, m.SubnetId, cloudformation.Select(strconv.Itoa(i), []string{cloudformation.Ref(ParameterSubnetIds)}))
+	}
+	ap := template.Resources["DbdataAccessPoint"].(*efs.AccessPoint)
+	assert.Equal(t, ap.FileSystemId, fileSystem)
+	assert.Equal(t, ap.PosixUser.Uid, "999")
+	assert.Equal(t, ap.RootDirectory.Path, "/data")
+	assert.Equal(t, ap.RootDirectory.CreationInfo.OwnerGid, "999")
+
+	def := template.Resources["TestTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, def.Volumes[0].Name, "Dbdata")
+	assert.Equal(t, def.Volumes[0].EFSVolumeConfiguration.FilesystemId, fileSystem)
+	mount := def.ContainerDefinitions[0].MountPoints[0]
+	assert.Equal(t, mount.SourceVolume, "Dbdata")
+	assert.Equal(t, mount.ContainerPath, "/var/lib/postgresql/data")
+
+	s := template.Resources["TestService"].(*ecs.Service)
+	assert.Equal(t, s.PlatformVersion, FargatePlatformVersion)
+	assert.Check(t, contains(s.AWSCloudFormationDependsOn, "DbdataNFSMountTargetOnSubnet1"))
+	assert.Check(t, contains(s.AWSCloudFormationDependsOn, "DbdataNFSMountTargetOnSubnet2"))
+}
+
+func TestRetainedFileSystems(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: postgres
+    volumes:
+      - db-data:/var/lib/postgresql/data
+      - logs:/var/log
+      - shared:/shared
+volumes:
+  db-data:
+  logs:
+  shared:
+    x-aws-efs: fs-shared
+`)
+	b := &Backend{api: fakeAPI{fileSystems: map[string]string{
+		"db-data": "fs-123",
+		"logs":    "fs-456",
+		"shared":  "fs-shared",
+	}}}
+	// the logs file system is managed by the stack already
+	retained, err := b.getRetainedFileSystems(context.TODO(), model, map[string]string{"LogsFilesystem": "fs-456"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, retained, map[string]string{"ParameterDbdataFilesystem": "fs-123"})
+}
+
+func TestVolumeMountTargetPerZone(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: postgres
+    volumes:
+      - db-data:/var/lib/postgresql/data
+volumes:
+  db-data: {}
+`)
+	// converting doesn't query the VPC subnets, mount targets are conditioned on the subnets parameter
+	template, err := Backend{}.Convert(model)
+	assert.NilError(t, err)
+	subnets := cloudformation.Split(",", cloudformation.Join("", []string{
+		cloudformation.Join(",", cloudformation.Ref(ParameterSubnetIds)),
+		",,,,,,",
+	}))
+	for i := 1; i <= MaxZones; i++ {
+		m := template.Resources[fmt.Sprintf("DbdataNFSMountTargetOnSubnet%d", i)].(*efs.MountTarget)
+		condition := fmt.Sprintf("HasSubnet%d", i)
+		assert.Equal(t, m.AWSCloudFormationCondition, condition)
+		assert.Equal(t, template.Conditions[condition], cloudformation.Not([]string{
+			cloudformation.Equals("", cloudformation.Select(strconv.Itoa(i-1), []string{subnets})),
+		}))
+	}
+	s := template.Resources["TestService"].(*ecs.Service)
+	assert.Equal(t, len(s.AWSCloudFormationDependsOn), MaxZones)
+
+	json, err := cf.Marshall(template)
+	assert.NilError(t, err)
+	assert.Check(t, strings.Contains(string(json), `"HasSubnet3": {
+      "Fn::Not": [
+        {
+          "Fn::Equals": [
+            "",
+            {
+              "Fn::Select": [
+                "2",
+                {
+                  "Fn::Split": [
+                    ",",
+                    {
+                      "Fn::Join": [
+                        "",
+                        [
+                          {
+                            "Fn::Join": [
+                              ",",
+                              {
+                                "Ref": "ParameterSubnetIds"
+                              }
+                            ]
+                          },
+                          ",,,,,,"
+                        ]
+                      ]
+                    }
+                  ]
+                }
+              ]
+            }
+          ]
+        }
+      ]
+    }`), string(json))
+}
+
+func TestSubnetsListParameter(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    ports:
+      - 80:80
+`)
+	json, err := cf.Marshall(template)
+	assert.NilError(t, err)
+	assert.Check(t, strings.Contains(string(json), `"Subnets": {
+              "Ref": "ParameterSubnetIds"
+            }`), string(json))
+}
+
+func TestExistingEFSVolume(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  test:
+    image: nginx
+    volumes:
+      - uploads:/uploads:ro
+volumes:
+  uploads:
+    x-aws-efs: fs-123abc
+`)
+	for _, r := range template.Resources {
+		assert.Check(t, r.AWSCloudFormationType() != "AWS::EFS::FileSystem")
+		assert.Check(t, r.AWSCloudFormationType() != "AWS::EFS::MountTarget")
+	}
+	ap := template.Resources["UploadsAccessPoint"].(*efs.AccessPoint)
+	assert.Equal(t, ap.FileSystemId, "fs-123abc")
+	def := template.Resources["TestTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, def.Volumes[0].EFSVolumeConfiguration.FilesystemId, "fs-123abc")
+	assert.Check(t, def.ContainerDefinitions[0].MountPoints[0].ReadOnly)
+}
+
+func TestBindMountIsIncompatible(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    volumes:
+      - ./html:/usr/share/nginx/html
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "incompatible")
+}
+
+func TestAnonymousVolumeIsIncompatible(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: postgres
+`)
+	// compose-go only loads anonymous volumes when skipping the consistency check
+	model.Services[0].Volumes = []types.ServiceVolumeConfig{
+		{Type: types.VolumeTypeVolume, Target: "/var/lib/postgresql/data"},
+	}
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "incompatible")
+}
+
+func TestInvalidEFSVolume(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    volumes:
+      - uploads:/uploads
+volumes:
+  uploads:
+    x-aws-efs: 123
+`)
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "volume uploads: x-aws-efs must be the ID of an EFS file system")
+}
+
 func get(l []ecs.TaskDefinition_KeyValuePair, name string) string {
 	for _, e := range l {
 		if e.Name == name {
@@ -325,7 +2222,7 @@ services:
 			k := tags.Index(i).FieldByName("Key").String()
 			v := tags.Index(i).FieldByName("Value").String()
 			if k == compose.ProjectTag {
-				assert.Equal(t, v, "Test")
+				assert.Equal(t, v, "test")
 			}
 		}
 	}
@@ -343,7 +2240,7 @@ func convertResultAsString(t *testing.T, project *types.Project) string {
 
 func load(t *testing.T, paths ...string) *types.Project {
 	options := cli.ProjectOptions{
-		Name:        t.Name(),
+		Name:        strings.ToLower(t.Name()),
 		ConfigPaths: paths,
 	}
 	project, err := cli.ProjectFromOptions(&options)
@@ -351,6 +2248,657 @@ func load(t *testing.T, paths ...string) *types.Project {
 	return project
 }
 
+func TestCollidingResourceNames(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  my-api:
+    image: api
+    networks:
+      - back_end
+  myapi:
+    image: api
+    networks:
+      - backend
+  web:
+    image: nginx
+    networks:
+      - backend
+networks:
+  back_end:
+  backend:
+`)
+	// alphanumeric names keep their logical ID, other colliding names get a suffix
+	s := template.Resources["MyapiService"].(*ecs.Service)
+	assert.Equal(t, s.TaskDefinition, cloudformation.Ref("MyapiTaskDefinition"))
+	def := template.Resources["MyapiTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, def.Family, "test-myapi")
+	s = template.Resources[fmt.Sprintf("Myapi%sService", nameHash("my-api"))].(*ecs.Service)
+	assert.Equal(t, s.TaskDefinition, cloudformation.Ref(fmt.Sprintf("Myapi%sTaskDefinition", nameHash("my-api"))))
+	def = template.Resources[fmt.Sprintf("Myapi%sTaskDefinition", nameHash("my-api"))].(*ecs.TaskDefinition)
+	assert.Equal(t, def.Family, "test-my-api")
+	_, ok := template.Resources["WebService"]
+	assert.Check(t, ok)
+	_, ok = template.Resources[fmt.Sprintf("TestBackend%sNetwork", nameHash("back_end"))]
+	assert.Check(t, ok)
+	_, ok = template.Resources["TestBackendNetwork"]
+	assert.Check(t, ok)
+
+	// names which don't collide never get a suffix
+	template = convertYaml(t, "test", `
+services:
+  my-api:
+    image: api
+`)
+	_, ok = template.Resources["MyapiService"]
+	assert.Check(t, ok)
+
+	model := loadConfig(t, "test", fmt.Sprintf(`
+services:
+  my-api:
+    image: api
+  myapi:
+    image: api
+  myapi%s:
+    image: api
+`, nameHash("my-api")))
+	_, err := Backend{}.Convert(model)
+	assert.ErrorContains(t, err, "can't be converted into distinct CloudFormation logical IDs")
+
+	// among alphanumeric names, the one equal to its logical ID keeps it, or the lexically first one
+	names := []string{"myapi", "Myapi", "my-api"}
+	assert.Equal(t, logicalName("Myapi", names), "Myapi")
+	assert.Equal(t, logicalName("myapi", names), "Myapi"+nameHash("myapi"))
+	assert.Equal(t, logicalName("my-api", names), "Myapi"+nameHash("my-api"))
+	assert.NilError(t, checkLogicalNames(loadConfig(t, "test", `
+services:
+  myapi:
+    image: api
+  Myapi:
+    image: api
+`)))
+}
+
+func TestLoadBalancerNameCollision(t *testing.T) {
+	names := map[string]bool{}
+	for _, project := range []string{"averylongprojectnameforthisapplication", "averylongprojectnameforthisapplication2"} {
+		model := loadConfig(t, project, `
+services:
+  web:
+    image: nginx
+    ports:
+      - 80:80
+`)
+		model.Name = project
+		template, err := Backend{}.Convert(model)
+		assert.NilError(t, err)
+		for name, r := range template.Resources {
+			if lb, ok := r.(*elasticloadbalancingv2.LoadBalancer); ok {
+				assert.Equal(t, lb.Name, name)
+				assert.Equal(t, len(lb.Name), 32)
+				names[lb.Name] = true
+			}
+		}
+	}
+	assert.Equal(t, len(names), 2)
+
+	for project, expected := range map[string]string{
+		"test":   "TestLoadBalancer",
+		"my-app": "My-AppLoadBalancer",
+		"my_app": "MyappLoadBalancer" + nameHash("my_app"),
+	} {
+		model := loadConfig(t, project, `
+services:
+  web:
+    image: nginx
+    ports:
+      - 80:80
+`)
+		model.Name = project
+		assert.Equal(t, getLoadBalancerName(model), expected)
+		template, err := Backend{}.Convert(model)
+		assert.NilError(t, err)
+		lb := template.Resources[normalizeResourceName(expected)].(*elasticloadbalancingv2.LoadBalancer)
+		assert.Equal(t, lb.Name, expected)
+	}
+}
+
+func TestTaskRequest(t *testing.T) {
+	model := loadConfig(t, "test", `
+services:
+  test:
+    image: nginx
+    x-aws-capacity_provider_strategy:
+      - capacity_provider: FARGATE_SPOT
+        weight: 1
+  proxy:
+    image: envoy
+    x-aws-sidecar-of: test
+`)
+	b := &Backend{api: fakeAPI{
+		resources: map[string]string{
+			"Cluster":            "cluster",
+			"TestTaskDefinition": "arn:task",
+			"TestDefaultNetwork": "sg-123",
+		},
+		parameters: map[string]string{
+			ParameterSubnetIds: "subnet-1,subnet-2",
+		},
+	}}
+	task, err := b.getTaskRequest(context.TODO(), model, "proxy")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, task, compose.TaskRequest{
+		Cluster:        "cluster",
+		TaskDefinition: "arn:task",
+		CapacityProviderStrategy: []compose.CapacityProviderStrategyItem{
+			{CapacityProvider: "FARGATE_SPOT", Weight: 1},
+		},
+		Subnets:        []string{"subnet-1", "subnet-2"},
+		SecurityGroups: []string{"sg-123"},
+		AssignPublicIP: ecsapi.AssignPublicIpEnabled,
+		Container:      "proxy",
+	})
+
+	model.Extensions = map[string]interface{}{
+		compose.ExtensionEC2: map[string]interface{}{"instance_type": "c5.large"},
+	}
+	b.api.(fakeAPI).resources[EC2CapacityProvider] = "capacity-provider"
+	task, err = b.getTaskRequest(context.TODO(), model, "test")
+	assert.NilError(t, err)
+	assert.Equal(t, task.LaunchType, "")
+	assert.Equal(t, task.PlatformVersion, "")
+	assert.DeepEqual(t, task.CapacityProviderStrategy, []compose.CapacityProviderStrategyItem{
+		{CapacityProvider: "capacity-provider", Weight: 1},
+	})
+
+	_, err = b.getTaskRequest(context.TODO(), model, "unknown")
+	assert.ErrorContains(t, err, "no such service")
+}
+
+func TestRun(t *testing.T) {
+	dir := fs.NewDir(t, "run", fs.WithFile("docker-compose.yml", `
+services:
+  test:
+    image: nginx
+`))
+	defer dir.Remove()
+	options, err := cli.NewProjectOptions([]string{dir.Join("docker-compose.yml")}, cli.WithName("test"))
+	assert.NilError(t, err)
+
+	task := &compose.TaskRequest{}
+	b := &Backend{api: fakeAPI{
+		resources: map[string]string{
+			"Cluster":            "cluster",
+			"TestTaskDefinition": "arn:task",
+		},
+		parameters: map[string]string{},
+		task:       task,
+		exitCode:   3,
+	}}
+	exitCode, err := b.Run(context.TODO(), options, "test", []string{"echo", "hello"}, ioutil.Discard)
+	assert.NilError(t, err)
+	assert.Equal(t, exitCode, 3)
+	assert.Equal(t, task.Container, "test")
+	assert.DeepEqual(t, task.Command, []string{"echo", "hello"})
+}
+
+func TestRunLogStreams(t *testing.T) {
+	project := loadConfig(t, "test", `
+services:
+  web:
+    image: nginx
+  api:
+    image: api
+    logging:
+      options:
+        awslogs-stream-prefix: backend
+        awslogs-group: /shared/logs
+  worker:
+    image: worker
+    logging:
+      driver: splunk
+      options:
+        splunk-url: https://splunk.example.com
+`)
+	group, stream, err := containerLogStream(project, "web", "abc")
+	assert.NilError(t, err)
+	assert.Equal(t, group, "/docker-compose/test")
+	assert.Equal(t, stream, "test/web/abc")
+
+	group, stream, err = containerLogStream(project, "api", "abc")
+	assert.NilError(t, err)
+	assert.Equal(t, group, "/shared/logs")
+	assert.Equal(t, stream, "backend/api/abc")
+
+	_, _, err = containerLogStream(project, "worker", "abc")
+	assert.ErrorContains(t, err, "container worker logs with the splunk driver, its logs can't be streamed")
+
+	// the FireLens log router logs to the project log group
+	group, stream, err = containerLogStream(project, LogRouterContainerName, "abc")
+	assert.NilError(t, err)
+	assert.Equal(t, group, "/docker-compose/test")
+	assert.Equal(t, stream, fmt.Sprintf("test/%s/abc", LogRouterContainerName))
+}
+
+func TestExec(t *testing.T) {
+	dir := fs.NewDir(t, "exec",
+		fs.WithFile("docker-compose.yml", `
+services:
+  test:
+    image: nginx
+    x-aws-exec: true
+  proxy:
+    image: envoy
+    x-aws-sidecar-of: test
+  other:
+    image: nginx
+`),
+	)
+	defer dir.Remove()
+	agent := newFakeAgent(t, "SessionType", nil, "")
+	defer agent.Close()
+	options, err := cli.NewProjectOptions([]string{dir.Join("docker-compose.yml")}, cli.WithName("test"))
+	assert.NilError(t, err)
+
+	command := ""
+	b := &Backend{Region: "eu-west-3", api: fakeAPI{
+		resources: map[string]string{
+			"Cluster":     "cluster",
+			"TestService": "arn:aws:ecs:eu-west-3:123456789012:service/cluster/test-TestService-1",
+		},
+		parameters: map[string]string{},
+		running: map[string][]compose.TaskStatus{
+			"test-TestService-1": {
+				{
+					// replaced task, which ECS Exec agent is stopped
+					ARN:    "arn:aws:ecs:eu-west-3:123456789012:task/cluster/old",
+					Status: ecsapi.DesiredStatusStopped,
+					Containers: []compose.ContainerStatus{
+						{Name: "proxy", RuntimeID: "old-222", ExecuteCommandAgent: ecsapi.DesiredStatusStopped},
+					},
+				},
+				{
+					// task started before ECS Exec was enabled
+					ARN:    "arn:aws:ecs:eu-west-3:123456789012:task/cluster/def",
+					Status: ecsapi.DesiredStatusRunning,
+					Containers: []compose.ContainerStatus{
+						{Name: "test", RuntimeID: "def-111"},
+						{Name: "proxy", RuntimeID: "def-222"},
+					},
+				},
+				{
+					ARN:    "arn:aws:ecs:eu-west-3:123456789012:task/cluster/abc",
+					Status: ecsapi.DesiredStatusRunning,
+					Containers: []compose.ContainerStatus{
+						{Name: "test", RuntimeID: "abc-111", ExecuteCommandAgent: ecsapi.DesiredStatusRunning},
+						{Name: "proxy", RuntimeID: "abc-222", ExecuteCommandAgent: ecsapi.DesiredStatusRunning},
+					},
+				},
+			},
+			// one-off task run from the same task definition family
+			"": {
+				{
+					ARN:    "arn:aws:ecs:eu-west-3:123456789012:task/cluster/run",
+					Status: ecsapi.DesiredStatusRunning,
+					Containers: []compose.ContainerStatus{
+						{Name: "proxy", RuntimeID: "run-222", ExecuteCommandAgent: ecsapi.DesiredStatusRunning},
+					},
+				},
+			},
+		},
+		command:   &command,
+		streamURL: "ws" + strings.TrimPrefix(agent.URL, "http"),
+	}}
+	assert.NilError(t, b.Exec(context.TODO(), options, "proxy", []string{"sh", "-c", "echo 'hello world'"}))
+	assert.Equal(t, command, `sh -c 'echo '"'"'hello world'"'"''`)
+
+	err = b.Exec(context.TODO(), options, "other", nil)
+	assert.ErrorContains(t, err, "service other doesn't enable ECS Exec")
+
+	b.api.(fakeAPI).running["test-TestService-1"] = b.api.(fakeAPI).running["test-TestService-1"][:2]
+	err = b.Exec(context.TODO(), options, "proxy", nil)
+	assert.ErrorContains(t, err, "ECS Exec agent is not running in container proxy")
+}
+
+func TestExecSession(t *testing.T) {
+	agent := newFakeAgent(t, "SessionType", []string{"hello ", "world", "\n"}, "exit\n")
+	defer agent.Close()
+	s, err := openExecSession(context.TODO(), compose.ExecSession{
+		SessionID:  "session",
+		StreamURL:  "ws" + strings.TrimPrefix(agent.URL, "http"),
+		TokenValue: "token",
+	})
+	assert.NilError(t, err)
+	out := bytes.Buffer{}
+	assert.NilError(t, s.run(context.TODO(), strings.NewReader("exit\n"), &out))
+	// output sent out of order is written in sequence
+	assert.Equal(t, out.String(), "hello world\n")
+	assert.Equal(t, agent.received(), "exit\n")
+	assert.DeepEqual(t, agent.acknowledged(), []int64{0, 1, 2, 3, 4})
+
+	kms := newFakeAgent(t, "KMSEncryption", nil, "")
+	defer kms.Close()
+	s, err = openExecSession(context.TODO(), compose.ExecSession{
+		SessionID:  "session",
+		StreamURL:  "ws" + strings.TrimPrefix(kms.URL, "http"),
+		TokenValue: "token",
+	})
+	assert.NilError(t, err)
+	err = s.run(context.TODO(), strings.NewReader(""), &out)
+	assert.ErrorContains(t, err, "session requires KMSEncryption, which is not supported")
+}
+
+func TestBuildContext(t *testing.T) {
+	dir := fs.NewDir(t, "context",
+		fs.WithFile("Dockerfile", "FROM scratch"),
+		fs.WithFile(".dockerignore", "*.log\nnode_modules\n"),
+		fs.WithFile("app.go", "package main"),
+		fs.WithFile("debug.log", ""),
+		fs.WithDir("node_modules", fs.WithFile("index.js", "")),
+	)
+	defer dir.Remove()
+
+	reader, err := createBuildContext(dir.Path(), "Dockerfile")
+	assert.NilError(t, err)
+	defer reader.Close()
+	files := []string{}
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		files = append(files, header.Name)
+	}
+	assert.DeepEqual(t, files, []string{".dockerignore", "Dockerfile", "app.go"})
+
+	_, err = createBuildContext(dir.Path(), "build/Dockerfile")
+	assert.ErrorContains(t, err, "cannot locate Dockerfile")
+}
+
+func TestConvertBuild(t *testing.T) {
+	template := convertYaml(t, "test", `
+services:
+  app:
+    build: app
+  web:
+    image: nginx
+`)
+	def := template.Resources["AppTaskDefinition"].(*ecs.TaskDefinition)
+	// up sets the parameter to the pushed digest
+	assert.Equal(t, def.ContainerDefinitions[0].Image, cloudformation.Ref("ParameterAppImage"))
+	assert.Equal(t, template.Parameters["ParameterAppImage"].Default, nil)
+	def = template.Resources["WebTaskDefinition"].(*ecs.TaskDefinition)
+	assert.Equal(t, def.ContainerDefinitions[0].Image, "nginx")
+	_, ok := template.Parameters["ParameterWebImage"]
+	assert.Check(t, !ok)
+}
+
+func TestCheckBeforeBuild(t *testing.T) {
+	// up checks the project before it builds any image
+	err := check(loadConfig(t, "test", `
+services:
+  app:
+    build: app
+  web:
+    image: nginx
+    cap_add:
+      - NET_ADMIN
+`))
+	assert.ErrorContains(t, err, "compose file is incompatible with Amazon ECS")
+}
+
+func TestEventWriter(t *testing.T) {
+	events := &recordedEvents{}
+	w := &eventWriter{writer: events, id: "test/app"}
+	fmt.Fprint(w, "Step 1/2 : FROM scratch\n ---> Running")
+	fmt.Fprint(w, " in 123\n\n")
+	assert.DeepEqual(t, events.statuses, []string{"Step 1/2 : FROM scratch", "---> Running in 123"})
+}
+
+type recordedEvents struct {
+	progress.Writer
+	statuses []string
+}
+
+func (r *recordedEvents) Event(e progress.Event) {
+	r.statuses = append(r.statuses, e.StatusText)
+}
+
+func TestRepositoryName(t *testing.T) {
+	project := loadConfig(t, "test", `
+services:
+  Web:
+    build: .
+`)
+	assert.Equal(t, repositoryName(project, project.Services[0]), "test/web")
+}
+
+// fakeAPI answers the queries of up and run with a VPC which subnets are in the availability zones of zones,
+// and a deployed stack, other calls panic
+type fakeAPI struct {
+	sdk.API
+	zones      map[string]string
+	resources  map[string]string
+	parameters map[string]string
+	// task records the task run by RunTask, which stops with exitCode
+	task     *compose.TaskRequest
+	exitCode int
+	// running are the tasks ListTasks returns by service name, command records the command ExecuteCommand runs
+	running map[string][]compose.TaskStatus
+	command *string
+	// streamURL is the URL of the SSM data channel of the sessions ExecuteCommand opens
+	streamURL string
+	// fileSystems are the IDs of the file systems tagged for volumes
+	fileSystems map[string]string
+}
+
+func (f fakeAPI) FindFileSystem(ctx context.Context, tags map[string]string) (string, error) {
+	return f.fileSystems[tags[compose.VolumeTag]], nil
+}
+
+func (s fakeAPI) GetDefaultVPC(ctx context.Context) (string, error) {
+	return "vpc-123", nil
+}
+
+func (s fakeAPI) GetSubNets(ctx context.Context, vpcID string) ([]string, error) {
+	ids := []string{}
+	for id := range s.zones {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s fakeAPI) GetSubnetZones(ctx context.Context, subnetIDs []string) (map[string]string, error) {
+	return s.zones, nil
+}
+
+func (f fakeAPI) ListStackResources(ctx context.Context, name string) ([]compose.StackResource, error) {
+	resources := []compose.StackResource{}
+	for id, arn := range f.resources {
+		resources = append(resources, compose.StackResource{
+			LogicalID: id,
+			ARN:       arn,
+		})
+	}
+	return resources, nil
+}
+
+func (f fakeAPI) ListStackParameters(ctx context.Context, name string) (map[string]string, error) {
+	return f.parameters, nil
+}
+
+func (f fakeAPI) RunTask(ctx context.Context, task compose.TaskRequest) (string, error) {
+	*f.task = task
+	return "arn:aws:ecs:eu-west-3:123456789012:task/cluster/abc", nil
+}
+
+func (f fakeAPI) ListTasks(ctx context.Context, cluster string, service string) ([]string, error) {
+	arns := []string{}
+	for _, task := range f.running[service] {
+		arns = append(arns, task.ARN)
+	}
+	return arns, nil
+}
+
+func (f fakeAPI) ExecuteCommand(ctx context.Context, cluster string, task string, container string, command string) (compose.ExecSession, error) {
+	*f.command = command
+	return compose.ExecSession{
+		SessionID:  "session",
+		StreamURL:  f.streamURL,
+		TokenValue: "token",
+	}, nil
+}
+
+func (f fakeAPI) DescribeTasks(ctx context.Context, cluster string, arns ...string) ([]compose.TaskStatus, error) {
+	if f.task == nil {
+		tasks := []compose.TaskStatus{}
+		for _, running := range f.running {
+			for _, task := range running {
+				if contains(arns, task.ARN) {
+					tasks = append(tasks, task)
+				}
+			}
+		}
+		return tasks, nil
+	}
+	return []compose.TaskStatus{
+		{
+			ARN:    arns[0],
+			Status: ecsapi.DesiredStatusStopped,
+			Containers: []compose.ContainerStatus{
+				{
+					Name:     f.task.Container,
+					ExitCode: &f.exitCode,
+				},
+			},
+		},
+	}, nil
+}
+
+func (f fakeAPI) GetTaskLogs(ctx context.Context, logGroup string, streams []string, startTime int64, consumer compose.LogConsumer) (int64, error) {
+	return startTime, nil
+}
+
+// fakeAgent is an SSM data channel, run by the agent of a container. It requests action in the handshake, sends
+// output in reverse order and closes the channel once all of it is acknowledged and input is received.
+type fakeAgent struct {
+	*httptest.Server
+	lock  sync.Mutex
+	acks  []int64
+	input string
+}
+
+func newFakeAgent(t *testing.T, action string, output []string, input string) *fakeAgent {
+	agent := &fakeAgent{}
+	upgrader := websocket.Upgrader{}
+	agent.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_, open, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if !strings.Contains(string(open), `"TokenValue":"token"`) {
+			t.Errorf("unexpected open data channel message %s", open)
+			return
+		}
+		send := func(messageType string, sequence int64, payloadType uint32, payload string) error {
+			return conn.WriteMessage(websocket.BinaryMessage, sessionMessage{
+				MessageType:    messageType,
+				SchemaVersion:  1,
+				SequenceNumber: sequence,
+				MessageID:      newMessageID(),
+				PayloadType:    payloadType,
+				Payload:        []byte(payload),
+			}.marshal())
+		}
+		// receive records the acknowledgements and input of the client until done
+		receive := func(done func() bool) bool {
+			for !done() {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					return false
+				}
+				m, err := unmarshalSessionMessage(data)
+				if err != nil {
+					t.Error(err)
+					return false
+				}
+				agent.lock.Lock()
+				switch {
+				case m.MessageType == messageAcknowledge:
+					ack := acknowledgeContent{}
+					if err := json.Unmarshal(m.Payload, &ack); err != nil {
+						t.Error(err)
+					}
+					agent.acks = append(agent.acks, ack.AcknowledgedMessageSequenceNumber)
+				case m.MessageType == messageInputStreamData && m.PayloadType == payloadOutput:
+					agent.input += string(m.Payload)
+				case m.MessageType == messageInputStreamData && m.PayloadType == payloadHandshakeResponse:
+					if !strings.Contains(string(m.Payload), fmt.Sprintf(`{"ActionType":"%s","ActionStatus":1}`, action)) {
+						t.Errorf("unexpected handshake response %s", m.Payload)
+					}
+					agent.acks = append(agent.acks, -1)
+				}
+				agent.lock.Unlock()
+			}
+			return true
+		}
+		count := func(acks int, input string) func() bool {
+			return func() bool {
+				agent.lock.Lock()
+				defer agent.lock.Unlock()
+				return len(agent.acks) >= acks && len(agent.input) >= len(input)
+			}
+		}
+
+		handshake := fmt.Sprintf(`{"AgentVersion":"3.0.0","RequestedClientActions":[{"ActionType":"%s"}]}`, action)
+		if send(messageOutputStreamData, 0, payloadHandshakeRequest, handshake) != nil || !receive(count(2, "")) {
+			return
+		}
+		if send(messageOutputStreamData, 1, payloadHandshakeComplete, "{}") != nil {
+			return
+		}
+		for i := len(output) - 1; i >= 0; i-- {
+			if send(messageOutputStreamData, int64(i+2), payloadOutput, output[i]) != nil {
+				return
+			}
+		}
+		if !receive(count(len(output)+3, input)) {
+			return
+		}
+		_ = send(messageChannelClosed, 0, payloadOutput, "")
+	}))
+	return agent
+}
+
+// acknowledged returns the sequence numbers of the output acknowledged by the client
+func (a *fakeAgent) acknowledged() []int64 {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	acks := []int64{}
+	for _, ack := range a.acks {
+		if ack >= 0 {
+			acks = append(acks, ack)
+		}
+	}
+	sort.Slice(acks, func(i, j int) bool { return acks[i] < acks[j] })
+	return acks
+}
+
+// received returns the input sent by the client
+func (a *fakeAgent) received() string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.input
+}
+
 func convertYaml(t *testing.T, name string, yaml string) *cloudformation.Template {
 	model := loadConfig(t, name, yaml)
 	template, err := Backend{}.Convert(model)
@@ -366,7 +2914,7 @@ func loadConfig(t *testing.T, name string, yaml string) *types.Project {
 			{Config: dict},
 		},
 	}, func(options *loader.Options) {
-		options.Name = "Test"
+		options.SetProjectName("test", true)
 	})
 	assert.NilError(t, err)
 	return model
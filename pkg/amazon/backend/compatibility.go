@@ -1,8 +1,13 @@
 package backend
 
 import (
-	"github.com/compose-spec/compose-go/compatibility"
+	"strconv"
+	"strings"
+
+	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compatibility"
+	"github.com/docker/ecs-plugin/pkg/compose"
 )
 
 type FargateCompatibilityChecker struct {
@@ -10,6 +15,15 @@ type FargateCompatibilityChecker struct {
 }
 
 var compatibleComposeAttributes = []string{
+	"services.build",
+	"services.build.args",
+	"services.build.cache_from",
+	"services.build.context",
+	"services.build.dockerfile",
+	"services.build.extra_hosts",
+	"services.build.labels",
+	"services.build.network",
+	"services.build.target",
 	"services.command",
 	"services.container_name",
 	"services.cap_drop",
@@ -22,7 +36,10 @@ var compatibleComposeAttributes = []string{
 	"services.deploy.resources.reservations",
 	"services.deploy.resources.reservations.cpus",
 	"services.deploy.resources.reservations.memory",
+	"services.deploy.resources.reservations.generic_resources",
 	"services.deploy.update_config",
+	"services.deploy.update_config.failure_action",
+	"services.deploy.update_config.order",
 	"services.deploy.update_config.parallelism",
 	"services.entrypoint",
 	"services.environment",
@@ -40,30 +57,51 @@ var compatibleComposeAttributes = []string{
 	"services.networks",
 	"services.ports",
 	"services.ports.mode",
+	"services.ports.published",
 	"services.ports.target",
 	"services.ports.protocol",
 	"services.secrets",
 	"services.secrets.source",
 	"services.secrets.target",
 	"services.user",
+	"services.volumes",
+	"services.volumes.read_only",
+	"services.volumes.source",
+	"services.volumes.target",
 	"services.working_dir",
 	"secrets.external",
 	"secrets.name",
 	"secrets.file",
+	"volumes.driver_opts",
+}
+
+// ec2ComposeAttributes are supported when the project is deployed on EC2 instances by x-aws-ec2
+var ec2ComposeAttributes = []string{
+	"services.deploy.placement",
+	"services.deploy.placement.constraints",
+	"services.deploy.placement.preferences",
+	"services.deploy.resources.reservations.devices",
+	"services.deploy.resources.reservations.generic_resources.discrete_resource_spec",
+	"services.devices",
+	"services.shm_size",
+	"services.tmpfs",
+	"services.volumes.tmpfs",
+	"services.volumes.tmpfs.size",
 }
 
 func (c *FargateCompatibilityChecker) CheckImage(service *types.ServiceConfig) {
-	if service.Image == "" {
+	if service.Image == "" && service.Build == nil {
 		c.Incompatible("service %s doesn't define a Docker image to run", service.Name)
 	}
 }
 
 func (c *FargateCompatibilityChecker) CheckPortsPublished(p *types.ServicePortConfig) {
-	if p.Published == 0 {
-		p.Published = p.Target
+	if p.Published == "" {
+		p.Published = strconv.FormatUint(uint64(p.Target), 10)
+		return
 	}
-	if p.Published != p.Target {
-		c.Incompatible("published port can't be set to a distinct value than container port")
+	if _, err := strconv.ParseUint(p.Published, 10, 16); err != nil {
+		c.Incompatible("published port %s must be a single port number", p.Published)
 	}
 }
 
@@ -80,8 +118,136 @@ func (c *FargateCompatibilityChecker) CheckCapAdd(service *types.ServiceConfig)
 	service.CapAdd = add
 }
 
+func (c *FargateCompatibilityChecker) CheckNetworkMode(service *types.ServiceConfig) {
+	if strings.HasPrefix(service.NetworkMode, "service:") {
+		// service runs as a sidecar container
+		return
+	}
+	c.AllowList.CheckNetworkMode(service)
+}
+
 func (c *FargateCompatibilityChecker) CheckLoggingDriver(config *types.LoggingConfig) {
-	if config.Driver != "" && config.Driver != "awslogs" {
+	switch config.Driver {
+	case "", ecsapi.LogDriverAwslogs, ecsapi.LogDriverAwsfirelens, ecsapi.LogDriverSplunk, ecsapi.LogDriverFluentd:
+	default:
 		c.Unsupported("services.logging.driver %s is not supported", config.Driver)
 	}
 }
+
+func (c *FargateCompatibilityChecker) CheckServiceVolumes(service *types.ServiceConfig) bool {
+	if !c.AllowList.CheckServiceVolumes(service) {
+		return false
+	}
+	for _, v := range service.Volumes {
+		switch {
+		case v.Type == types.VolumeTypeVolume && v.Source == "":
+			c.Incompatible("service %s: anonymous volumes are not supported by ECS, %s must mount a named volume", service.Name, v.Target)
+		case v.Type == types.VolumeTypeVolume:
+		case v.Type == types.VolumeTypeTmpfs && c.supports("services.volumes.tmpfs"):
+		case v.Type == types.VolumeTypeTmpfs:
+			c.Incompatible("service %s: tmpfs mounts are not supported by Fargate, %s requires EC2 instances", service.Name, v.Target)
+		default:
+			c.Incompatible("service %s: only named volumes are supported by ECS, %s volume on %s can't be mounted", service.Name, v.Type, v.Target)
+		}
+	}
+	return true
+}
+
+// CheckTmpfs, CheckShmSize and CheckDevices reject Linux parameters Fargate doesn't support, rather than ignoring them
+func (c *FargateCompatibilityChecker) CheckTmpfs(service *types.ServiceConfig) {
+	if len(service.Tmpfs) > 0 && !c.supports("services.tmpfs") {
+		c.Incompatible("service %s: tmpfs mounts are not supported by Fargate, they require EC2 instances", service.Name)
+	}
+}
+
+func (c *FargateCompatibilityChecker) CheckShmSize(service *types.ServiceConfig) {
+	if service.ShmSize != 0 && !c.supports("services.shm_size") {
+		c.Incompatible("service %s: shm_size is not supported by Fargate, it requires EC2 instances", service.Name)
+	}
+}
+
+func (c *FargateCompatibilityChecker) CheckDevices(service *types.ServiceConfig) {
+	if len(service.Devices) > 0 && !c.supports("services.devices") {
+		c.Incompatible("service %s: devices are not supported by Fargate, they require EC2 instances", service.Name)
+	}
+}
+
+// CheckDeployResourcesReservations only accepts GPUs as devices or generic resources, which require EC2 instances.
+// Other devices and generic resources are left in the project and ignored by the conversion.
+func (c *FargateCompatibilityChecker) CheckDeployResourcesReservations(config *types.DeployConfig) bool {
+	if !c.AllowList.CheckDeployResourcesReservations(config) {
+		return false
+	}
+	for _, d := range config.Resources.Reservations.Devices {
+		switch {
+		case !contains(d.Capabilities, "gpu"):
+			c.Unsupported("services.deploy.resources.reservations.devices other than gpu")
+		case !c.supports("services.deploy.resources.reservations.devices"):
+			c.Incompatible("GPU reservations are not supported by Fargate, they require EC2 instances")
+		case d.Count <= 0 && len(d.IDs) == 0:
+			c.Incompatible("GPU reservations must set a count, ECS can't reserve all the GPUs of an instance")
+		case len(d.IDs) > 0:
+			c.Unsupported("services.deploy.resources.reservations.devices.device_ids, ECS reserves any %d GPUs", len(d.IDs))
+		}
+	}
+	for _, r := range config.Resources.Reservations.GenericResources {
+		switch {
+		case r.DiscreteResourceSpec == nil || !strings.EqualFold(r.DiscreteResourceSpec.Kind, "gpu"):
+			c.Unsupported("services.deploy.resources.reservations.generic_resources other than gpu")
+		case !c.supports("services.deploy.resources.reservations.generic_resources.discrete_resource_spec"):
+			c.Incompatible("GPU reservations are not supported by Fargate, they require EC2 instances")
+		}
+	}
+	return true
+}
+
+// CheckUpdateConfigDelay and CheckUpdateConfigMonitor explain why these rolling update settings are ignored
+func (c *FargateCompatibilityChecker) CheckUpdateConfigDelay(s string, config *types.UpdateConfig) {
+	if config.Delay != 0 {
+		c.Unsupported("services.deploy.%s.delay, ECS replaces the next tasks as soon as replacements are healthy", s)
+	}
+}
+
+func (c *FargateCompatibilityChecker) CheckUpdateConfigMonitor(s string, config *types.UpdateConfig) {
+	if config.Monitor != 0 {
+		c.Unsupported("services.deploy.%s.monitor, ECS deployment circuit breaker set by failure_action detects failed tasks instead", s)
+	}
+}
+
+// CheckPlacementConstraints and CheckPlacementPreferences reject placement settings which can't be converted into ECS
+// placement constraints and strategies
+func (c *FargateCompatibilityChecker) CheckPlacementConstraints(p *types.Placement) {
+	c.AllowList.CheckPlacementConstraints(p)
+	for _, constraint := range p.Constraints {
+		if _, ok := toPlacementExpression(constraint); !ok {
+			c.Incompatible("placement constraint %q is not supported by ECS, only node.labels, node.platform.os, node.platform.arch and attribute: expressions are", constraint)
+		}
+	}
+}
+
+func (c *FargateCompatibilityChecker) CheckPlacementPreferences(p *types.Placement) {
+	c.AllowList.CheckPlacementPreferences(p)
+	for _, preference := range p.Preferences {
+		if _, ok := toPlacementField(preference.Spread); !ok {
+			c.Incompatible("placement preference spread %q is not supported by ECS, only node.labels, instanceId and attribute: fields are", preference.Spread)
+		}
+	}
+}
+
+func (c *FargateCompatibilityChecker) supports(attribute string) bool {
+	for _, s := range c.Supported {
+		if s == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *FargateCompatibilityChecker) CheckVolumeConfigExternal(config *types.VolumeConfig) {
+	if !config.External.External {
+		return
+	}
+	if _, ok := config.Extensions[compose.ExtensionEFS]; !ok {
+		c.Incompatible("external volume %s must set %s to the ID of an existing EFS file system", config.Name, compose.ExtensionEFS)
+	}
+}
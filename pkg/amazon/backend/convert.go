@@ -19,20 +19,74 @@ import (
 	"github.com/docker/cli/opts"
 	"github.com/docker/ecs-plugin/pkg/compose"
 	"github.com/docker/ecs-plugin/secrets"
+	"github.com/docker/go-units"
 	"github.com/joho/godotenv"
 )
 
-const secretsInitContainerImage = "docker/ecs-secrets-sidecar"
+const (
+	secretsInitContainerImage = "docker/ecs-secrets-sidecar"
 
-func Convert(project *types.Project, service types.ServiceConfig) (*ecs.TaskDefinition, error) {
-	cpu, mem, err := toLimits(service)
+	// LogRouterContainerName is the Fluent Bit container injected into tasks using the awsfirelens log driver
+	LogRouterContainerName = "log_router"
+	// LogRouterImage is the AWS distribution of Fluent Bit, which bundles plugins for common log destinations
+	LogRouterImage = "public.ecr.aws/aws-observability/aws-for-fluent-bit:stable"
+	// LogRouterMemoryReservation is the memory, in MiB, AWS recommends to reserve for the log router
+	LogRouterMemoryReservation = 50
+
+	// DefaultTmpfsSize is the size, in MiB, of tmpfs mounts which don't set one
+	DefaultTmpfsSize = 100
+)
+
+// Convert a compose service into a task definition, running sidecar containers along the service container
+func Convert(project *types.Project, service types.ServiceConfig, sidecars ...types.ServiceConfig) (*ecs.TaskDefinition, error) {
+	cpu, mem, err := toLimits(append([]types.ServiceConfig{service}, sidecars...)...)
 	if err != nil {
 		return nil, err
 	}
-	_, memReservation, err := toContainerReservation(service)
+
+	// containers running in the same task
+	local := map[string]bool{
+		service.Name: true,
+	}
+	for _, sidecar := range sidecars {
+		local[sidecar.Name] = true
+	}
+
+	containers, volumes, err := toContainerDefinitions(project, service, "secrets", local)
 	if err != nil {
 		return nil, err
 	}
+	for _, sidecar := range sidecars {
+		c, v, err := toContainerDefinitions(project, sidecar, fmt.Sprintf("%s_secrets", serviceLogicalName(project, sidecar.Name)), local)
+		if err != nil {
+			return nil, err
+		}
+		containers = append(containers, c...)
+		volumes = append(volumes, v...)
+	}
+
+	return &ecs.TaskDefinition{
+		ContainerDefinitions:    addLogRouter(project, containers),
+		Cpu:                     cpu,
+		Family:                  fmt.Sprintf("%s-%s", project.Name, service.Name),
+		IpcMode:                 service.Ipc,
+		Memory:                  mem,
+		NetworkMode:             ecsapi.NetworkModeAwsvpc, // FIXME could be set by service.NetworkMode, Fargate only supports network mode ‘awsvpc’.
+		PidMode:                 service.Pid,
+		PlacementConstraints:    toPlacementConstraints(service.Deploy),
+		ProxyConfiguration:      nil,
+		RequiresCompatibilities: []string{toCompatibility(project)},
+		Volumes:                 uniqueVolumes(volumes),
+	}, nil
+}
+
+// toContainerDefinitions converts a compose service into a container definition, preceded by an init container when
+// secrets have to be retrieved, and returns the task volumes those rely on
+func toContainerDefinitions(project *types.Project, service types.ServiceConfig, secretsVolume string, local map[string]bool) ([]ecs.TaskDefinition_ContainerDefinition, []ecs.TaskDefinition_Volume, error) {
+	_, memReservation, err := toContainerReservation(service)
+	if err != nil {
+		return nil, nil, err
+	}
 	credential := getRepoCredentials(service)
 
 	// override resolve.conf search directive to also search <project>.local
@@ -44,7 +98,10 @@ func Convert(project *types.Project, service types.ServiceConfig) (*ecs.TaskDefi
 			fmt.Sprintf(" %s.local", project.Name),
 		}))
 
-	logConfiguration := getLogConfiguration(service, project)
+	logConfiguration, err := getLogConfiguration(service, project)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	var (
 		containers     []ecs.TaskDefinition_ContainerDefinition
@@ -53,14 +110,14 @@ func Convert(project *types.Project, service types.ServiceConfig) (*ecs.TaskDefi
 		initContainers []ecs.TaskDefinition_ContainerDependency
 	)
 	if len(service.Secrets) > 0 {
-		initContainerName := fmt.Sprintf("%s_Secrets_InitContainer", normalizeResourceName(service.Name))
+		initContainerName := secretsInitContainerName(project, service)
 		volumes = append(volumes, ecs.TaskDefinition_Volume{
-			Name: "secrets",
+			Name: secretsVolume,
 		})
 		mounts = append(mounts, ecs.TaskDefinition_MountPoint{
 			ContainerPath: "/run/secrets/",
 			ReadOnly:      true,
-			SourceVolume:  "secrets",
+			SourceVolume:  secretsVolume,
 		})
 		initContainers = append(initContainers, ecs.TaskDefinition_ContainerDependency{
 			Condition:     ecsapi.ContainerConditionSuccess,
@@ -97,7 +154,7 @@ func Convert(project *types.Project, service types.ServiceConfig) (*ecs.TaskDefi
 		}
 		command, err := json.Marshal(args)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		containers = append(containers, ecs.TaskDefinition_ContainerDefinition{
 			Name:             initContainerName,
@@ -109,22 +166,36 @@ func Convert(project *types.Project, service types.ServiceConfig) (*ecs.TaskDefi
 				{
 					ContainerPath: "/run/secrets/",
 					ReadOnly:      false,
-					SourceVolume:  "secrets",
+					SourceVolume:  secretsVolume,
 				},
 			},
 			Secrets: taskSecrets,
 		})
 	}
 
+	efsVolumes, efsMounts := toVolumes(project, service)
+	volumes = append(volumes, efsVolumes...)
+	mounts = append(mounts, efsMounts...)
+
 	pairs, err := createEnvironment(project, service)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	dependencies, err := toContainerDependencies(project, service, local)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	linuxParameters, err := toLinuxParameters(service)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	containers = append(containers, ecs.TaskDefinition_ContainerDefinition{
 		Command:                service.Command,
 		DisableNetworking:      service.NetworkMode == "none",
-		DependsOnProp:          initContainers,
+		DependsOnProp:          append(initContainers, dependencies...),
 		DnsSearchDomains:       service.DNSSearch,
 		DnsServers:             service.DNS,
 		DockerSecurityOptions:  service.SecurityOpt,
@@ -135,10 +206,10 @@ func Convert(project *types.Project, service types.ServiceConfig) (*ecs.TaskDefi
 		FirelensConfiguration:  nil,
 		HealthCheck:            toHealthCheck(service.HealthCheck),
 		Hostname:               service.Hostname,
-		Image:                  service.Image,
+		Image:                  getImage(project, service),
 		Interactive:            false,
 		Links:                  nil,
-		LinuxParameters:        toLinuxParameters(service),
+		LinuxParameters:        linuxParameters,
 		LogConfiguration:       logConfiguration,
 		MemoryReservation:      memReservation,
 		MountPoints:            mounts,
@@ -148,7 +219,7 @@ func Convert(project *types.Project, service types.ServiceConfig) (*ecs.TaskDefi
 		PseudoTerminal:         service.Tty,
 		ReadonlyRootFilesystem: service.ReadOnly,
 		RepositoryCredentials:  credential,
-		ResourceRequirements:   nil,
+		ResourceRequirements:   toResourceRequirements(service),
 		StartTimeout:           0,
 		StopTimeout:            durationToInt(service.StopGracePeriod),
 		SystemControls:         toSystemControls(service.Sysctls),
@@ -158,19 +229,24 @@ func Convert(project *types.Project, service types.ServiceConfig) (*ecs.TaskDefi
 		WorkingDirectory:       service.WorkingDir,
 	})
 
-	return &ecs.TaskDefinition{
-		ContainerDefinitions:    containers,
-		Cpu:                     cpu,
-		Family:                  fmt.Sprintf("%s-%s", project.Name, service.Name),
-		IpcMode:                 service.Ipc,
-		Memory:                  mem,
-		NetworkMode:             ecsapi.NetworkModeAwsvpc, // FIXME could be set by service.NetworkMode, Fargate only supports network mode ‘awsvpc’.
-		PidMode:                 service.Pid,
-		PlacementConstraints:    toPlacementConstraints(service.Deploy),
-		ProxyConfiguration:      nil,
-		RequiresCompatibilities: []string{ecsapi.LaunchTypeFargate},
-		Volumes:                 volumes,
-	}, nil
+	return containers, volumes, nil
+}
+
+// secretsInitContainerName is the container retrieving the secrets of a service before it starts
+func secretsInitContainerName(project *types.Project, service types.ServiceConfig) string {
+	return fmt.Sprintf("%s_Secrets_InitContainer", serviceLogicalName(project, service.Name))
+}
+
+func uniqueVolumes(volumes []ecs.TaskDefinition_Volume) []ecs.TaskDefinition_Volume {
+	var unique []ecs.TaskDefinition_Volume
+	known := map[string]bool{}
+	for _, v := range volumes {
+		if !known[v.Name] {
+			known[v.Name] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
 }
 
 func createEnvironment(project *types.Project, service types.ServiceConfig) ([]ecs.TaskDefinition_KeyValuePair, error) {
@@ -193,7 +269,8 @@ func createEnvironment(project *types.Project, service types.ServiceConfig) ([]e
 			return nil, err
 		}
 		for k, v := range env {
-			environment[k] = &v
+			value := v
+			environment[k] = &value
 		}
 	}
 	for k, v := range service.Environment {
@@ -212,27 +289,91 @@ func createEnvironment(project *types.Project, service types.ServiceConfig) ([]e
 			Value: value,
 		})
 	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Name < pairs[j].Name
+	})
 	return pairs, nil
 }
 
-func getLogConfiguration(service types.ServiceConfig, project *types.Project) *ecs.TaskDefinition_LogConfiguration {
-	options := map[string]string{
-		"awslogs-region":        cloudformation.Ref("AWS::Region"),
-		"awslogs-group":         cloudformation.Ref("LogGroup"),
-		"awslogs-stream-prefix": project.Name,
-	}
-	if service.Logging != nil {
-		for k, v := range service.Logging.Options {
-			if strings.HasPrefix(k, "awslogs-") {
-				options[k] = v
+// getLogConfiguration sets the log driver of a container. awslogs, the default, sends logs to the project log group,
+// while splunk, fluentd and awsfirelens options are passed through as is
+func getLogConfiguration(service types.ServiceConfig, project *types.Project) (*ecs.TaskDefinition_LogConfiguration, error) {
+	driver := ecsapi.LogDriverAwslogs
+	if service.Logging != nil && service.Logging.Driver != "" {
+		driver = service.Logging.Driver
+	}
+	switch driver {
+	case ecsapi.LogDriverAwslogs:
+		options := map[string]string{
+			"awslogs-region":        cloudformation.Ref("AWS::Region"),
+			"awslogs-group":         cloudformation.Ref(logGroupResourceName(project, service)),
+			"awslogs-stream-prefix": project.Name,
+		}
+		if service.Logging != nil {
+			for k, v := range service.Logging.Options {
+				if strings.HasPrefix(k, "awslogs-") {
+					options[k] = v
+				}
 			}
 		}
+		return &ecs.TaskDefinition_LogConfiguration{
+			LogDriver: ecsapi.LogDriverAwslogs,
+			Options:   options,
+		}, nil
+	case ecsapi.LogDriverFluentd:
+		if !usesEC2(project) {
+			return nil, fmt.Errorf("service %s: %s logging driver is only supported on EC2 instances, use %s to route logs to Fluentd on Fargate", service.Name, driver, ecsapi.LogDriverAwsfirelens)
+		}
+		fallthrough
+	case ecsapi.LogDriverSplunk, ecsapi.LogDriverAwsfirelens:
+		return &ecs.TaskDefinition_LogConfiguration{
+			LogDriver: driver,
+			Options:   service.Logging.Options,
+		}, nil
+	default:
+		return nil, fmt.Errorf("service %s: unsupported logging driver %s", service.Name, driver)
 	}
-	logConfiguration := &ecs.TaskDefinition_LogConfiguration{
-		LogDriver: ecsapi.LogDriverAwslogs,
-		Options:   options,
+}
+
+// addLogRouter adds the Fluent Bit container FireLens routes logs through to a task which containers use the
+// awsfirelens log driver, and makes those start after it
+func addLogRouter(project *types.Project, containers []ecs.TaskDefinition_ContainerDefinition) []ecs.TaskDefinition_ContainerDefinition {
+	firelens := false
+	for i, container := range containers {
+		if container.LogConfiguration == nil || container.LogConfiguration.LogDriver != ecsapi.LogDriverAwsfirelens {
+			continue
+		}
+		firelens = true
+		containers[i].DependsOnProp = append(container.DependsOnProp, ecs.TaskDefinition_ContainerDependency{
+			Condition:     ecsapi.ContainerConditionStart,
+			ContainerName: LogRouterContainerName,
+		})
 	}
-	return logConfiguration
+	if !firelens {
+		return containers
+	}
+	router := ecs.TaskDefinition_ContainerDefinition{
+		Name:      LogRouterContainerName,
+		Image:     LogRouterImage,
+		Essential: true,
+		FirelensConfiguration: &ecs.TaskDefinition_FirelensConfiguration{
+			Type: "fluentbit",
+			Options: map[string]string{
+				"enable-ecs-log-metadata": "true",
+			},
+		},
+		// the log router can't log through itself
+		LogConfiguration: &ecs.TaskDefinition_LogConfiguration{
+			LogDriver: ecsapi.LogDriverAwslogs,
+			Options: map[string]string{
+				"awslogs-region":        cloudformation.Ref("AWS::Region"),
+				"awslogs-group":         cloudformation.Ref("LogGroup"),
+				"awslogs-stream-prefix": project.Name,
+			},
+		},
+		MemoryReservation: LogRouterMemoryReservation,
+	}
+	return append([]ecs.TaskDefinition_ContainerDefinition{router}, containers...)
 }
 
 func toTags(labels types.Labels) []tags.Tag {
@@ -243,6 +384,9 @@ func toTags(labels types.Labels) []tags.Tag {
 			Value: v,
 		})
 	}
+	sort.Slice(t, func(i, j int) bool {
+		return t[i].Key < t[j].Key
+	})
 	return t
 }
 
@@ -254,12 +398,16 @@ func toSystemControls(sysctls types.Mapping) []ecs.TaskDefinition_SystemControl
 			Value:     v,
 		})
 	}
+	sort.Slice(sys, func(i, j int) bool {
+		return sys[i].Namespace < sys[j].Namespace
+	})
 	return sys
 }
 
 const MiB = 1024 * 1024
 
-func toLimits(service types.ServiceConfig) (string, string, error) {
+// toLimits selects the smallest Fargate task size which fits the resource limits of all containers
+func toLimits(services ...types.ServiceConfig) (string, string, error) {
 	// All possible cpu/mem values for Fargate
 	cpuToMem := map[int64][]types.UnitBytes{
 		256:  {512, 1024, 2048},
@@ -271,24 +419,32 @@ func toLimits(service types.ServiceConfig) (string, string, error) {
 	cpuLimit := "256"
 	memLimit := "512"
 
-	if service.Deploy == nil {
-		return cpuLimit, memLimit, nil
-	}
-
-	limits := service.Deploy.Resources.Limits
-	if limits == nil {
-		return cpuLimit, memLimit, nil
+	var (
+		v           int64
+		memoryBytes types.UnitBytes
+	)
+	for _, service := range services {
+		if service.Deploy == nil {
+			continue
+		}
+		limits := service.Deploy.Resources.Limits
+		if limits == nil {
+			continue
+		}
+		// containers may only limit cpus or memory, the task has to fit the sum of each of them
+		if limits.NanoCPUs != "" {
+			cpus, err := opts.ParseCPUs(limits.NanoCPUs)
+			if err != nil {
+				return "", "", err
+			}
+			v += cpus
+		}
+		memoryBytes += limits.MemoryBytes
 	}
-
-	if limits.NanoCPUs == "" {
+	if v == 0 && memoryBytes == 0 {
 		return cpuLimit, memLimit, nil
 	}
 
-	v, err := opts.ParseCPUs(limits.NanoCPUs)
-	if err != nil {
-		return "", "", err
-	}
-
 	var cpus []int64
 	for k := range cpuToMem {
 		cpus = append(cpus, k)
@@ -299,7 +455,7 @@ func toLimits(service types.ServiceConfig) (string, string, error) {
 		mem := cpuToMem[cpu]
 		if v <= cpu*MiB {
 			for _, m := range mem {
-				if limits.MemoryBytes <= m*MiB {
+				if memoryBytes <= m*MiB {
 					cpuLimit = strconv.FormatInt(cpu, 10)
 					memLimit = strconv.FormatInt(int64(m), 10)
 					return cpuLimit, memLimit, nil
@@ -332,15 +488,26 @@ func toRequiresCompatibilities(isolation string) []*string {
 	return []*string{&isolation}
 }
 
+func toCompatibility(project *types.Project) string {
+	if usesEC2(project) {
+		return ecsapi.CompatibilityEc2
+	}
+	return ecsapi.CompatibilityFargate
+}
+
 func toPlacementConstraints(deploy *types.DeployConfig) []ecs.TaskDefinition_TaskDefinitionPlacementConstraint {
 	if deploy == nil || deploy.Placement.Constraints == nil || len(deploy.Placement.Constraints) == 0 {
 		return nil
 	}
 	pl := []ecs.TaskDefinition_TaskDefinitionPlacementConstraint{}
 	for _, c := range deploy.Placement.Constraints {
+		expression, ok := toPlacementExpression(c)
+		if !ok {
+			continue
+		}
 		pl = append(pl, ecs.TaskDefinition_TaskDefinitionPlacementConstraint{
-			Expression: c,
-			Type:       "",
+			Expression: expression,
+			Type:       ecsapi.PlacementConstraintTypeMemberOf,
 		})
 	}
 	return pl
@@ -352,9 +519,10 @@ func toPortMappings(ports []types.ServicePortConfig) []ecs.TaskDefinition_PortMa
 	}
 	m := []ecs.TaskDefinition_PortMapping{}
 	for _, p := range ports {
+		// with awsvpc network mode, host port must match container port. Published port is exposed by load balancer
 		m = append(m, ecs.TaskDefinition_PortMapping{
 			ContainerPort: int(p.Target),
-			HostPort:      int(p.Published),
+			HostPort:      int(p.Target),
 			Protocol:      p.Protocol,
 		})
 	}
@@ -373,33 +541,138 @@ func toUlimits(ulimits map[string]*types.UlimitsConfig) []ecs.TaskDefinition_Uli
 			HardLimit: v.Hard,
 		})
 	}
+	sort.Slice(u, func(i, j int) bool {
+		return u[i].Name < u[j].Name
+	})
 	return u
 }
 
-func toLinuxParameters(service types.ServiceConfig) *ecs.TaskDefinition_LinuxParameters {
+func toLinuxParameters(service types.ServiceConfig) (*ecs.TaskDefinition_LinuxParameters, error) {
+	shmSize := 0
+	if service.ShmSize > 0 {
+		shmSize = toMiB(int64(service.ShmSize))
+	}
+	tmpfs, err := toTmpfs(service)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := toDevices(service)
+	if err != nil {
+		return nil, err
+	}
 	return &ecs.TaskDefinition_LinuxParameters{
 		Capabilities:       toKernelCapabilities(service.CapAdd, service.CapDrop),
-		Devices:            nil,
+		Devices:            devices,
 		InitProcessEnabled: service.Init != nil && *service.Init,
 		MaxSwap:            0,
-		// FIXME SharedMemorySize:   service.ShmSize,
-		Swappiness: 0,
-		Tmpfs:      toTmpfs(service.Tmpfs),
-	}
+		SharedMemorySize:   shmSize,
+		Swappiness:         0,
+		Tmpfs:              tmpfs,
+	}, nil
 }
 
-func toTmpfs(tmpfs types.StringList) []ecs.TaskDefinition_Tmpfs {
-	if tmpfs == nil || len(tmpfs) == 0 {
+// toResourceRequirements reserves the GPUs a service requires
+func toResourceRequirements(service types.ServiceConfig) []ecs.TaskDefinition_ResourceRequirement {
+	gpus := getGPUs(service)
+	if gpus == 0 {
 		return nil
 	}
+	return []ecs.TaskDefinition_ResourceRequirement{
+		{
+			Type:  ecsapi.ResourceTypeGpu,
+			Value: strconv.Itoa(gpus),
+		},
+	}
+}
+
+// toMiB converts a size in bytes to MiB, as ECS expects for tmpfs and shared memory sizes, rounding up
+func toMiB(size int64) int {
+	return int((size + units.MiB - 1) / units.MiB)
+}
+
+// toTmpfs converts tmpfs mounts, set with the tmpfs short syntax as path[:options] or as tmpfs volumes, into ECS
+// tmpfs mounts. Size is required on ECS but unlimited by the compose spec, so mounts without a size get a default one
+func toTmpfs(service types.ServiceConfig) ([]ecs.TaskDefinition_Tmpfs, error) {
 	o := []ecs.TaskDefinition_Tmpfs{}
-	for _, path := range tmpfs {
-		o = append(o, ecs.TaskDefinition_Tmpfs{
-			ContainerPath: path,
-			Size:          100, // size is required on ECS, unlimited by the compose spec
-		})
+	for _, t := range service.Tmpfs {
+		tmpfs := ecs.TaskDefinition_Tmpfs{
+			Size: DefaultTmpfsSize,
+		}
+		parts := strings.SplitN(t, ":", 2)
+		tmpfs.ContainerPath = parts[0]
+		if len(parts) == 2 {
+			for _, option := range strings.Split(parts[1], ",") {
+				if !strings.HasPrefix(option, "size=") {
+					tmpfs.MountOptions = append(tmpfs.MountOptions, option)
+					continue
+				}
+				size, err := units.RAMInBytes(strings.TrimPrefix(option, "size="))
+				if err != nil {
+					return nil, fmt.Errorf("service %s: invalid tmpfs size on %s: %s", service.Name, tmpfs.ContainerPath, err)
+				}
+				tmpfs.Size = toMiB(size)
+			}
+		}
+		o = append(o, tmpfs)
 	}
-	return o
+	for _, v := range service.Volumes {
+		if v.Type != types.VolumeTypeTmpfs {
+			continue
+		}
+		tmpfs := ecs.TaskDefinition_Tmpfs{
+			ContainerPath: v.Target,
+			Size:          DefaultTmpfsSize,
+		}
+		if v.Tmpfs != nil && v.Tmpfs.Size > 0 {
+			tmpfs.Size = toMiB(int64(v.Tmpfs.Size))
+		}
+		if v.ReadOnly {
+			tmpfs.MountOptions = []string{"ro"}
+		}
+		o = append(o, tmpfs)
+	}
+	if len(o) == 0 {
+		return nil, nil
+	}
+	return o, nil
+}
+
+// toDevices converts devices set as host_path[:container_path[:permissions]] into ECS devices, permissions being a
+// combination of r, w and m as for docker run --device
+func toDevices(service types.ServiceConfig) ([]ecs.TaskDefinition_Device, error) {
+	if len(service.Devices) == 0 {
+		return nil, nil
+	}
+	devices := []ecs.TaskDefinition_Device{}
+	for _, d := range service.Devices {
+		parts := strings.Split(d, ":")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("service %s: invalid device %s", service.Name, d)
+		}
+		device := ecs.TaskDefinition_Device{
+			HostPath:      parts[0],
+			ContainerPath: parts[0],
+		}
+		if len(parts) > 1 {
+			device.ContainerPath = parts[1]
+		}
+		if len(parts) > 2 {
+			for _, p := range parts[2] {
+				switch p {
+				case 'r':
+					device.Permissions = append(device.Permissions, ecsapi.DeviceCgroupPermissionRead)
+				case 'w':
+					device.Permissions = append(device.Permissions, ecsapi.DeviceCgroupPermissionWrite)
+				case 'm':
+					device.Permissions = append(device.Permissions, ecsapi.DeviceCgroupPermissionMknod)
+				default:
+					return nil, fmt.Errorf("service %s: invalid device permissions %s", service.Name, parts[2])
+				}
+			}
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
 }
 
 func toKernelCapabilities(add []string, drop []string) *ecs.TaskDefinition_KernelCapabilities {
@@ -453,6 +726,15 @@ func toHostEntryPtr(hosts types.HostsList) []ecs.TaskDefinition_HostEntry {
 	return e
 }
 
+// getImage returns the image a service runs. Services with a build section run the image digest up pushes to their
+// ECR repository, passed as a parameter.
+func getImage(project *types.Project, service types.ServiceConfig) string {
+	if service.Build == nil {
+		return service.Image
+	}
+	return cloudformation.Ref(imageParameterName(project, service.Name))
+}
+
 func getRepoCredentials(service types.ServiceConfig) *ecs.TaskDefinition_RepositoryCredentials {
 	// extract registry and namespace string from image name
 	for key, value := range service.Extensions {
@@ -0,0 +1,268 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+
+	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation"
+	"github.com/awslabs/goformation/v4/cloudformation/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation/iam"
+	"github.com/awslabs/goformation/v4/cloudformation/lambda"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	ConditionServiceStarted               = "service_started"
+	ConditionServiceHealthy               = "service_healthy"
+	ConditionServiceCompletedSuccessfully = "service_completed_successfully"
+
+	ServiceWaitFunction     = "ServiceWaitFunction"
+	ServiceWaitFunctionRole = "ServiceWaitFunctionRole"
+
+	// ServiceWaitTimeout is the time, in seconds, a dependent service waits for its dependencies to be healthy, which
+	// is the maximum a Lambda function can run
+	ServiceWaitTimeout = 900
+)
+
+// serviceWaitFunctionCode waits for an ECS service to reach a steady state, with all its tasks healthy when they
+// define health checks, and enough healthy targets in the target groups of its load balancers
+const serviceWaitFunctionCode = `import time
+import boto3
+import cfnresponse
+
+ecs = boto3.client("ecs")
+elbv2 = boto3.client("elbv2")
+
+
+def ready(cluster, arn, healthcheck):
+    service = ecs.describe_services(cluster=cluster, services=[arn])["services"][0]
+    desired = service["desiredCount"]
+    # services deployed by CodeDeploy run task sets rather than deployments
+    rollouts = service.get("taskSets") or service["deployments"]
+    if len(rollouts) != 1 or service["runningCount"] < desired:
+        return False
+    if rollouts[0].get("stabilityStatus", "STEADY_STATE") != "STEADY_STATE":
+        return False
+    if healthcheck:
+        tasks = ecs.list_tasks(cluster=cluster, serviceName=service["serviceName"], desiredStatus="RUNNING")["taskArns"]
+        if len(tasks) < desired:
+            return False
+        for task in ecs.describe_tasks(cluster=cluster, tasks=tasks)["tasks"]:
+            if task.get("healthStatus") != "HEALTHY":
+                return False
+    for lb in service["loadBalancers"]:
+        targets = elbv2.describe_target_health(TargetGroupArn=lb["targetGroupArn"])["TargetHealthDescriptions"]
+        if len([t for t in targets if t["TargetHealth"]["State"] == "healthy"]) < desired:
+            return False
+    return True
+
+
+def handler(event, context):
+    if event["RequestType"] == "Delete":
+        cfnresponse.send(event, context, cfnresponse.SUCCESS, {}, event.get("PhysicalResourceId"))
+        return
+    properties = event["ResourceProperties"]
+    service = properties["Service"]
+    reason = "timed out waiting for %s to be healthy" % service
+    try:
+        while context.get_remaining_time_in_millis() > 30000:
+            if ready(properties["Cluster"], service, properties["HealthCheck"] == "true"):
+                cfnresponse.send(event, context, cfnresponse.SUCCESS, {}, service)
+                return
+            time.sleep(15)
+    except Exception as e:
+        reason = str(e)
+    cfnresponse.send(event, context, cfnresponse.FAILED, {}, service, reason=reason)
+`
+
+// serviceDependency is a depends_on entry, with the condition the dependency has to reach for the service to start
+type serviceDependency struct {
+	Service   string
+	Condition string `mapstructure:"condition"`
+}
+
+// getDependencies returns the dependencies of a service, sorted by name, with the condition depends_on sets. Conditions
+// set by x-aws-depends_on, using the same long syntax, override those of depends_on.
+func getDependencies(project *types.Project, service types.ServiceConfig) ([]serviceDependency, error) {
+	conditions := map[string]string{}
+	for name, dependency := range service.DependsOn {
+		conditions[name] = dependency.Condition
+	}
+	if ext, ok := service.Extensions[compose.ExtensionDependsOn]; ok {
+		dependencies := map[string]serviceDependency{}
+		if err := mapstructure.Decode(ext, &dependencies); err != nil {
+			return nil, fmt.Errorf("service %s: invalid %s: %s", service.Name, compose.ExtensionDependsOn, err)
+		}
+		for name, dependency := range dependencies {
+			conditions[name] = dependency.Condition
+		}
+	}
+
+	dependencies := []serviceDependency{}
+	for name, condition := range conditions {
+		switch condition {
+		case "":
+			condition = ConditionServiceStarted
+		case ConditionServiceStarted, ConditionServiceHealthy, ConditionServiceCompletedSuccessfully:
+		default:
+			return nil, fmt.Errorf("service %s: unsupported condition %q on %s", service.Name, condition, name)
+		}
+		if _, err := project.GetService(name); err != nil {
+			return nil, fmt.Errorf("service %s depends on %s: %s", service.Name, name, err)
+		}
+		dependencies = append(dependencies, serviceDependency{
+			Service:   name,
+			Condition: condition,
+		})
+	}
+	sort.Slice(dependencies, func(i, j int) bool {
+		return dependencies[i].Service < dependencies[j].Service
+	})
+	return dependencies, nil
+}
+
+// toContainerDependencies maps dependencies on containers running in the same task to container dependencies
+func toContainerDependencies(project *types.Project, service types.ServiceConfig, local map[string]bool) ([]ecs.TaskDefinition_ContainerDependency, error) {
+	dependencies, err := getDependencies(project, service)
+	if err != nil {
+		return nil, err
+	}
+	var containerDependencies []ecs.TaskDefinition_ContainerDependency
+	for _, dependency := range dependencies {
+		if !local[dependency.Service] {
+			continue
+		}
+		condition := ecsapi.ContainerConditionStart
+		switch dependency.Condition {
+		case ConditionServiceHealthy:
+			container, err := project.GetService(dependency.Service)
+			if err != nil {
+				return nil, err
+			}
+			if !hasHealthCheck(container) {
+				return nil, fmt.Errorf("service %s: %s has no healthcheck to wait for", service.Name, dependency.Service)
+			}
+			condition = ecsapi.ContainerConditionHealthy
+		case ConditionServiceCompletedSuccessfully:
+			condition = ecsapi.ContainerConditionSuccess
+		}
+		containerDependencies = append(containerDependencies, ecs.TaskDefinition_ContainerDependency{
+			Condition:     condition,
+			ContainerName: dependency.Service,
+		})
+	}
+	return containerDependencies, nil
+}
+
+// getServiceDependsOn returns the resources the ECS service running a task has to wait for, according to the
+// dependencies of its containers on containers running in other tasks
+func getServiceDependsOn(project *types.Project, service types.ServiceConfig, containers []types.ServiceConfig, template *cloudformation.Template, cluster string) ([]string, error) {
+	dependsOn := []string{}
+	for _, container := range containers {
+		dependencies, err := getDependencies(project, container)
+		if err != nil {
+			return nil, err
+		}
+		for _, dependency := range dependencies {
+			name := getServiceDependency(project, dependency.Service)
+			if name == service.Name {
+				// containers running in the same task rely on container dependencies
+				continue
+			}
+			if s, err := project.GetService(name); err == nil && isScheduled(s) {
+				if dependency.Condition != ConditionServiceStarted {
+					return nil, fmt.Errorf("service %s: scheduled task %s can't be waited for to be %s", container.Name, name, dependency.Condition)
+				}
+				// scheduled tasks don't run as a service to wait for
+				continue
+			}
+			switch dependency.Condition {
+			case ConditionServiceHealthy:
+				dependsOn = append(dependsOn, createServiceWait(project, name, template, cluster))
+			case ConditionServiceCompletedSuccessfully:
+				return nil, fmt.Errorf("service %s: %s can only wait for %s to complete when running in the same task, using %s", container.Name, dependency.Condition, dependency.Service, compose.ExtensionSidecarOf)
+			default:
+				dependsOn = append(dependsOn, serviceResourceName(project, name))
+			}
+		}
+	}
+	return dependsOn, nil
+}
+
+// createServiceWait creates a custom resource which only completes once the ECS service is healthy, for dependent
+// services to wait for, and returns its name. The wait runs again whenever the service task definition changes.
+func createServiceWait(project *types.Project, name string, template *cloudformation.Template, cluster string) string {
+	resource := fmt.Sprintf("%sHealthy", serviceLogicalName(project, name))
+	if _, ok := template.Resources[resource]; ok {
+		return resource
+	}
+	createServiceWaitFunction(template)
+
+	healthCheck := false
+	for _, s := range project.Services {
+		if (s.Name == name || sidecarOf(s) == name) && hasHealthCheck(s) {
+			healthCheck = true
+		}
+	}
+	template.Resources[resource] = &cloudformation.CustomResource{
+		Type: "Custom::ServiceHealthy",
+		Properties: map[string]interface{}{
+			"ServiceToken":   cloudformation.GetAtt(ServiceWaitFunction, "Arn"),
+			"Cluster":        cluster,
+			"Service":        cloudformation.Ref(serviceResourceName(project, name)),
+			"TaskDefinition": cloudformation.Ref(taskDefinitionResourceName(project, name)),
+			"HealthCheck":    healthCheck,
+		},
+	}
+	return resource
+}
+
+// createServiceWaitFunction creates the Lambda function backing the custom resources services wait for
+func createServiceWaitFunction(template *cloudformation.Template) {
+	if _, ok := template.Resources[ServiceWaitFunction]; ok {
+		return
+	}
+	template.Resources[ServiceWaitFunctionRole] = &iam.Role{
+		AssumeRolePolicyDocument: assumeRolePolicy("lambda.amazonaws.com"),
+		ManagedPolicyArns: []string{
+			LambdaBasicExecutionPolicy,
+		},
+		Policies: []iam.Role_Policy{
+			{
+				PolicyDocument: &PolicyDocument{
+					Version: "2012-10-17",
+					Statement: []PolicyStatement{
+						{
+							Effect: "Allow",
+							Action: []string{
+								ActionDescribeServices,
+								ActionListTasks,
+								ActionDescribeTasks,
+								ActionDescribeTargetHealth,
+							},
+							Resource: []string{"*"},
+						},
+					},
+				},
+				PolicyName: "WaitForServices",
+			},
+		},
+	}
+	template.Resources[ServiceWaitFunction] = &lambda.Function{
+		Code: &lambda.Function_Code{
+			ZipFile: serviceWaitFunctionCode,
+		},
+		Description: "Wait for ECS services to be healthy",
+		Handler:     "index.handler",
+		Role:        cloudformation.GetAtt(ServiceWaitFunctionRole, "Arn"),
+		Runtime:     "python3.12",
+		Timeout:     ServiceWaitTimeout,
+	}
+}
+
+func hasHealthCheck(service types.ServiceConfig) bool {
+	return service.HealthCheck != nil && !service.HealthCheck.Disable
+}
@@ -0,0 +1,433 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	codedeployapi "github.com/aws/aws-sdk-go/service/codedeploy"
+	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation"
+	"github.com/awslabs/goformation/v4/cloudformation/codedeploy"
+	"github.com/awslabs/goformation/v4/cloudformation/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation/elasticloadbalancingv2"
+	"github.com/awslabs/goformation/v4/cloudformation/iam"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/docker/ecs-plugin/pkg/progress"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	DeploymentRolling   = "rolling"
+	DeploymentBlueGreen = "blue_green"
+
+	// BlueGreenTestPortOffset is added to the published port to get the default port of the test listener, which
+	// routes requests to the replacement tasks of a blue/green deployment before production traffic is shifted
+	BlueGreenTestPortOffset = 10000
+
+	// BlueGreenDeploymentConfig shifts all production traffic at once when replacement tasks are ready
+	BlueGreenDeploymentConfig = "CodeDeployDefault.ECSAllAtOnce"
+
+	// BlueGreenTerminationWait is the time, in minutes, original tasks are kept after a successful deployment, so it
+	// can be rolled back instantly
+	BlueGreenTerminationWait = 60
+
+	CodeDeployApplication = "CodeDeployApplication"
+	CodeDeployRole        = "CodeDeployRole"
+)
+
+// getDeploymentController returns the deployment controller selected by x-aws-deployment, rolling update by default
+func getDeploymentController(service types.ServiceConfig) (string, error) {
+	ext, ok := service.Extensions[compose.ExtensionDeployment]
+	if !ok {
+		return ecsapi.DeploymentControllerTypeEcs, nil
+	}
+	switch ext {
+	case DeploymentRolling:
+		return ecsapi.DeploymentControllerTypeEcs, nil
+	case DeploymentBlueGreen:
+		return ecsapi.DeploymentControllerTypeCodeDeploy, nil
+	default:
+		return "", fmt.Errorf("service %s: %s must be one of %s or %s, got %v", service.Name, compose.ExtensionDeployment, DeploymentRolling, DeploymentBlueGreen, ext)
+	}
+}
+
+func usesBlueGreen(service types.ServiceConfig) bool {
+	return service.Extensions[compose.ExtensionDeployment] == DeploymentBlueGreen
+}
+
+// blueGreenTarget is the pair of target groups and the listeners a CodeDeploy deployment shifts traffic between
+type blueGreenTarget struct {
+	targetGroups []string
+	prodListener string
+	testListener string
+}
+
+// testListener is the content of the x-aws-test_listener extension
+type testListener struct {
+	Port int    `mapstructure:"port"`
+	CIDR string `mapstructure:"cidr"`
+}
+
+// getTestListener returns the test listener of a blue/green service for a published port. It listens on the published
+// port + BlueGreenTestPortOffset unless x-aws-test_listener sets another port, and is only reachable from the
+// networks of the project unless x-aws-test_listener sets a CIDR block to allow.
+func getTestListener(service types.ServiceConfig, port types.ServicePortConfig) (*testListener, error) {
+	test := &testListener{
+		Port: int(publishedPort(port)) + BlueGreenTestPortOffset,
+	}
+	if ext, ok := service.Extensions[compose.ExtensionTestListener]; ok {
+		if err := mapstructure.Decode(ext, test); err != nil {
+			return nil, fmt.Errorf("service %s: invalid %s: %s", service.Name, compose.ExtensionTestListener, err)
+		}
+	}
+	if test.Port < 1 || test.Port > 65535 {
+		return nil, fmt.Errorf("service %s: test listener port %d must be between 1 and 65535, set it by %s", service.Name, test.Port, compose.ExtensionTestListener)
+	}
+	if test.Port == int(publishedPort(port)) {
+		return nil, fmt.Errorf("service %s: test listener port must differ from published port %d", service.Name, publishedPort(port))
+	}
+	if test.CIDR != "" {
+		if _, _, err := net.ParseCIDR(test.CIDR); err != nil {
+			return nil, fmt.Errorf("service %s: invalid %s cidr: %s", service.Name, compose.ExtensionTestListener, err)
+		}
+	}
+	return test, nil
+}
+
+// addBlueGreenTarget creates the target group for the replacement tasks of a blue/green deployment, and a test
+// listener routing requests to them
+func addBlueGreenTarget(project *types.Project, service types.ServiceConfig, port types.ServicePortConfig, protocol string, certificate string, targetGroup string, template *cloudformation.Template, listeners listeners, test *testListener) (*blueGreenTarget, error) {
+	testPort := port
+	testPort.Published = strconv.Itoa(test.Port)
+
+	green := fmt.Sprintf("%sGreenTargetGroup", strings.TrimSuffix(targetGroup, "TargetGroup"))
+	replacement := *template.Resources[targetGroup].(*elasticloadbalancingv2.TargetGroup)
+	template.Resources[green] = &replacement
+
+	testListener, err := listeners.add(project, service, testPort, protocol, certificate, green, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &blueGreenTarget{
+		targetGroups: []string{targetGroup, green},
+		prodListener: listenerResourceName(project, protocol, port),
+		testListener: testListener,
+	}, nil
+}
+
+// setDeployedTaskDefinition adds a parameter for up to keep the task definition set on a blue/green service by the
+// previous stack update, as CloudFormation can't update a service with the CODE_DEPLOY deployment controller. New
+// revisions of the task definition are deployed by CodeDeploy instead
+func setDeployedTaskDefinition(project *types.Project, service types.ServiceConfig, template *cloudformation.Template, taskDefinition string) string {
+	parameter := taskDefinitionParameterName(project, service.Name)
+	template.Parameters[parameter] = cloudformation.Parameter{
+		Type:        "String",
+		Description: fmt.Sprintf("Task definition deployed by CodeDeploy for service %s (optional)", service.Name),
+		Default:     "",
+	}
+	condition := fmt.Sprintf("%sInitialTaskDefinition", serviceLogicalName(project, service.Name))
+	template.Conditions[condition] = cloudformation.Equals("", cloudformation.Ref(parameter))
+	return cloudformation.If(condition, cloudformation.Ref(taskDefinition), cloudformation.Ref(parameter))
+}
+
+// createDeploymentGroup creates the CodeDeploy deployment group shifting traffic of a blue/green service from the
+// original tasks to the replacement ones
+func createDeploymentGroup(project *types.Project, service types.ServiceConfig, template *cloudformation.Template, cluster string, target *blueGreenTarget) {
+	if _, ok := template.Resources[CodeDeployApplication]; !ok {
+		template.Resources[CodeDeployApplication] = &codedeploy.Application{
+			ComputePlatform: codedeployapi.ComputePlatformEcs,
+		}
+		template.Resources[CodeDeployRole] = &iam.Role{
+			AssumeRolePolicyDocument: assumeRolePolicy("codedeploy.amazonaws.com"),
+			ManagedPolicyArns: []string{
+				CodeDeployECSPolicy,
+			},
+		}
+	}
+
+	targetGroups := []codedeploy.DeploymentGroup_TargetGroupInfo{}
+	for _, tg := range target.targetGroups {
+		targetGroups = append(targetGroups, codedeploy.DeploymentGroup_TargetGroupInfo{
+			Name: cloudformation.GetAtt(tg, "TargetGroupName"),
+		})
+	}
+
+	template.Resources[deploymentGroupResourceName(project, service.Name)] = &deploymentGroup{
+		ApplicationName: cloudformation.Ref(CodeDeployApplication),
+		AutoRollbackConfiguration: &codedeploy.DeploymentGroup_AutoRollbackConfiguration{
+			Enabled: true,
+			Events: []string{
+				codedeployapi.AutoRollbackEventDeploymentFailure,
+				codedeployapi.AutoRollbackEventDeploymentStopOnRequest,
+			},
+		},
+		BlueGreenDeploymentConfiguration: &blueGreenDeploymentConfiguration{
+			DeploymentReadyOption: &deploymentReadyOption{
+				ActionOnTimeout: codedeployapi.DeploymentReadyActionContinueDeployment,
+			},
+			TerminateBlueInstancesOnDeploymentSuccess: &blueInstanceTerminationOption{
+				Action:                       codedeployapi.InstanceActionTerminate,
+				TerminationWaitTimeInMinutes: BlueGreenTerminationWait,
+			},
+		},
+		DeploymentConfigName: BlueGreenDeploymentConfig,
+		DeploymentStyle: &codedeploy.DeploymentGroup_DeploymentStyle{
+			DeploymentOption: codedeployapi.DeploymentOptionWithTrafficControl,
+			DeploymentType:   codedeployapi.DeploymentTypeBlueGreen,
+		},
+		ECSServices: []ecsService{
+			{
+				ClusterName: cluster,
+				ServiceName: cloudformation.GetAtt(serviceResourceName(project, service.Name), "Name"),
+			},
+		},
+		LoadBalancerInfo: &loadBalancerInfo{
+			TargetGroupPairInfoList: []targetGroupPairInfo{
+				{
+					ProdTrafficRoute: &trafficRoute{
+						ListenerArns: []string{cloudformation.Ref(target.prodListener)},
+					},
+					TargetGroups: targetGroups,
+					TestTrafficRoute: &trafficRoute{
+						ListenerArns: []string{cloudformation.Ref(target.testListener)},
+					},
+				},
+			},
+		},
+		ServiceRoleArn: cloudformation.GetAtt(CodeDeployRole, "Arn"),
+		AWSCloudFormationDependsOn: []string{
+			target.prodListener,
+			target.testListener,
+		},
+	}
+}
+
+func taskDefinitionParameterName(project *types.Project, service string) string {
+	return fmt.Sprintf("Parameter%sTaskDefinition", serviceLogicalName(project, service))
+}
+
+func taskDefinitionResourceName(project *types.Project, service string) string {
+	return fmt.Sprintf("%sTaskDefinition", serviceLogicalName(project, service))
+}
+
+func deploymentGroupResourceName(project *types.Project, service string) string {
+	return fmt.Sprintf("%sDeploymentGroup", serviceLogicalName(project, service))
+}
+
+// getDeployedTaskDefinitions returns the task definition CloudFormation last set on each blue/green service, indexed
+// by template parameter
+func (b *Backend) getDeployedTaskDefinitions(ctx context.Context, project *types.Project, template *cloudformation.Template, resources map[string]string) (map[string]string, error) {
+	stackParameters := map[string]string{}
+	if len(resources) > 0 {
+		var err error
+		stackParameters, err = b.api.ListStackParameters(ctx, project.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	deployed := map[string]string{}
+	for _, service := range project.Services {
+		parameter := taskDefinitionParameterName(project, service.Name)
+		if _, ok := template.Parameters[parameter]; !ok {
+			continue
+		}
+		arn := stackParameters[parameter]
+		if arn == "" {
+			// service was deployed with the task definition created by the stack
+			arn = resources[taskDefinitionResourceName(project, service.Name)]
+		}
+		deployed[parameter] = arn
+	}
+	return deployed, nil
+}
+
+// getStackResources indexes the physical IDs of the stack resources by logical ID, or returns an empty map if the
+// stack doesn't exist
+func (b *Backend) getStackResources(ctx context.Context, name string, exists bool) (map[string]string, error) {
+	resources := map[string]string{}
+	if !exists {
+		return resources, nil
+	}
+	list, err := b.api.ListStackResources(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		resources[r.LogicalID] = r.ARN
+	}
+	return resources, nil
+}
+
+// deployBlueGreenServices runs a CodeDeploy deployment for each blue/green service which task definition got a new
+// revision by the stack update
+func (b *Backend) deployBlueGreenServices(ctx context.Context, project *types.Project, template *cloudformation.Template, previous map[string]string) error {
+	resources, err := b.getStackResources(ctx, project.Name, true)
+	if err != nil {
+		return err
+	}
+	for _, service := range project.Services {
+		s, ok := template.Resources[serviceResourceName(project, service.Name)].(*ecs.Service)
+		if !ok || s.DeploymentController.Type != ecsapi.DeploymentControllerTypeCodeDeploy {
+			continue
+		}
+		taskDefinition := taskDefinitionResourceName(project, service.Name)
+		before, ok := previous[taskDefinition]
+		if !ok || before == resources[taskDefinition] {
+			// service has been created with the current task definition
+			continue
+		}
+		appSpec, err := getAppSpec(resources[taskDefinition], s.LoadBalancers[0])
+		if err != nil {
+			return err
+		}
+		id, err := b.api.CreateDeployment(ctx, resources[CodeDeployApplication], resources[deploymentGroupResourceName(project, service.Name)], appSpec)
+		if err != nil {
+			return err
+		}
+		if err := b.WaitDeploymentCompletion(ctx, project, service.Name, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitDeploymentCompletion reports progress of a blue/green deployment, until all production traffic has been
+// shifted to the replacement tasks or the deployment has been rolled back
+func (b *Backend) WaitDeploymentCompletion(ctx context.Context, project *types.Project, service string, id string) error {
+	w := progress.ContextWriter(ctx)
+	resource := serviceResourceName(project, service)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		deployment, err := b.api.DescribeDeployment(ctx, id)
+		if err != nil {
+			return err
+		}
+		switch deployment.Status {
+		case codedeployapi.DeploymentStatusSucceeded:
+			w.Event(progress.Event{
+				ID:         resource,
+				Status:     progress.Done,
+				StatusText: fmt.Sprintf("Deployment %s %s", id, deployment.Status),
+			})
+			return nil
+		case codedeployapi.DeploymentStatusFailed, codedeployapi.DeploymentStatusStopped:
+			w.Event(progress.Event{
+				ID:         resource,
+				Status:     progress.Error,
+				StatusText: fmt.Sprintf("Deployment %s %s", id, deployment.Status),
+			})
+			return fmt.Errorf("deployment %s of service %s %s: %s", id, service, strings.ToLower(deployment.Status), deployment.Message)
+		default:
+			w.Event(progress.Event{
+				ID:         resource,
+				Status:     progress.Working,
+				StatusText: fmt.Sprintf("Deployment %s %s, %.0f%% traffic shifted", id, deployment.Status, deployment.TrafficWeight),
+			})
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// getAppSpec returns the CodeDeploy AppSpec to deploy a task definition to a blue/green service
+func getAppSpec(taskDefinition string, lb ecs.Service_LoadBalancer) (string, error) {
+	spec := map[string]interface{}{
+		"version": json.Number("0.0"),
+		"Resources": []interface{}{
+			map[string]interface{}{
+				"TargetService": map[string]interface{}{
+					"Type": "AWS::ECS::Service",
+					"Properties": map[string]interface{}{
+						"TaskDefinition": taskDefinition,
+						"LoadBalancerInfo": map[string]interface{}{
+							"ContainerName": lb.ContainerName,
+							"ContainerPort": lb.ContainerPort,
+						},
+					},
+				},
+			},
+		},
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// deploymentGroup is an AWS::CodeDeploy::DeploymentGroup with the properties for ECS blue/green deployments, which
+// goformation doesn't support yet
+type deploymentGroup struct {
+	ApplicationName                  string                                                `json:",omitempty"`
+	AutoRollbackConfiguration        *codedeploy.DeploymentGroup_AutoRollbackConfiguration `json:",omitempty"`
+	BlueGreenDeploymentConfiguration *blueGreenDeploymentConfiguration                     `json:",omitempty"`
+	DeploymentConfigName             string                                                `json:",omitempty"`
+	DeploymentStyle                  *codedeploy.DeploymentGroup_DeploymentStyle           `json:",omitempty"`
+	ECSServices                      []ecsService                                          `json:",omitempty"`
+	LoadBalancerInfo                 *loadBalancerInfo                                     `json:",omitempty"`
+	ServiceRoleArn                   string                                                `json:",omitempty"`
+	AWSCloudFormationDependsOn       []string                                              `json:"-"`
+}
+
+type blueGreenDeploymentConfiguration struct {
+	DeploymentReadyOption                     *deploymentReadyOption         `json:",omitempty"`
+	TerminateBlueInstancesOnDeploymentSuccess *blueInstanceTerminationOption `json:",omitempty"`
+}
+
+type deploymentReadyOption struct {
+	ActionOnTimeout   string `json:",omitempty"`
+	WaitTimeInMinutes int    `json:",omitempty"`
+}
+
+type blueInstanceTerminationOption struct {
+	Action                       string `json:",omitempty"`
+	TerminationWaitTimeInMinutes int    `json:",omitempty"`
+}
+
+type ecsService struct {
+	ClusterName string `json:",omitempty"`
+	ServiceName string `json:",omitempty"`
+}
+
+type loadBalancerInfo struct {
+	TargetGroupPairInfoList []targetGroupPairInfo `json:",omitempty"`
+}
+
+type targetGroupPairInfo struct {
+	ProdTrafficRoute *trafficRoute                                `json:",omitempty"`
+	TargetGroups     []codedeploy.DeploymentGroup_TargetGroupInfo `json:",omitempty"`
+	TestTrafficRoute *trafficRoute                                `json:",omitempty"`
+}
+
+type trafficRoute struct {
+	ListenerArns []string `json:",omitempty"`
+}
+
+// AWSCloudFormationType returns the AWS CloudFormation resource type
+func (r *deploymentGroup) AWSCloudFormationType() string {
+	return "AWS::CodeDeploy::DeploymentGroup"
+}
+
+// MarshalJSON embeds the deployment group into a CloudFormation resource, like goformation resources do
+func (r deploymentGroup) MarshalJSON() ([]byte, error) {
+	type Properties deploymentGroup
+	return json.Marshal(&struct {
+		Type       string
+		Properties Properties
+		DependsOn  []string `json:"DependsOn,omitempty"`
+	}{
+		Type:       r.AWSCloudFormationType(),
+		Properties: (Properties)(r),
+		DependsOn:  r.AWSCloudFormationDependsOn,
+	})
+}
@@ -0,0 +1,345 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation"
+	"github.com/awslabs/goformation/v4/cloudformation/autoscaling"
+	"github.com/awslabs/goformation/v4/cloudformation/ec2"
+	"github.com/awslabs/goformation/v4/cloudformation/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation/iam"
+	"github.com/awslabs/goformation/v4/cloudformation/tags"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	ParameterEC2InstanceAMI = "ParameterEC2InstanceAMI"
+
+	// ECSOptimizedAMI is the SSM parameter for the latest recommended ECS-optimized Amazon Linux 2 AMI
+	ECSOptimizedAMI = "/aws/service/ecs/optimized-ami/amazon-linux-2/recommended/image_id"
+	// ECSOptimizedGPUAMI is the ECS-optimized AMI variant with NVIDIA drivers, required to run GPU workloads
+	ECSOptimizedGPUAMI = "/aws/service/ecs/optimized-ami/amazon-linux-2/gpu/recommended/image_id"
+
+	EC2CapacityProvider            = "EC2CapacityProvider"
+	EC2CapacityProviderAssociation = "EC2CapacityProviderAssociation"
+)
+
+// gpuInstanceTypes is the number of NVIDIA GPUs provided by instance types ECS can schedule GPU workloads on
+var gpuInstanceTypes = map[string]int{
+	"p2.xlarge":     1,
+	"p2.8xlarge":    8,
+	"p2.16xlarge":   16,
+	"p3.2xlarge":    1,
+	"p3.8xlarge":    4,
+	"p3.16xlarge":   8,
+	"p3dn.24xlarge": 8,
+	"p4d.24xlarge":  8,
+	"g3s.xlarge":    1,
+	"g3.4xlarge":    1,
+	"g3.8xlarge":    2,
+	"g3.16xlarge":   4,
+	"g4dn.xlarge":   1,
+	"g4dn.2xlarge":  1,
+	"g4dn.4xlarge":  1,
+	"g4dn.8xlarge":  1,
+	"g4dn.16xlarge": 1,
+	"g4dn.12xlarge": 4,
+	"g4dn.metal":    8,
+	"g5.xlarge":     1,
+	"g5.2xlarge":    1,
+	"g5.4xlarge":    1,
+	"g5.8xlarge":    1,
+	"g5.16xlarge":   1,
+	"g5.12xlarge":   4,
+	"g5.24xlarge":   4,
+	"g5.48xlarge":   8,
+}
+
+// ec2Instances is the content of the x-aws-ec2 extension
+type ec2Instances struct {
+	InstanceType string `mapstructure:"instance_type"`
+	// Count is the number of instances to start with
+	Count int `mapstructure:"count"`
+	// Max is the number of instances the capacity provider can scale out to
+	Max int `mapstructure:"max"`
+}
+
+// usesEC2 tells if the project is deployed on EC2 instances rather than on Fargate
+func usesEC2(project *types.Project) bool {
+	_, ok := project.Extensions[compose.ExtensionEC2]
+	return ok
+}
+
+func getEC2Instances(project *types.Project) (*ec2Instances, error) {
+	ext, ok := project.Extensions[compose.ExtensionEC2]
+	if !ok {
+		return nil, nil
+	}
+	instances := &ec2Instances{
+		Count: 1,
+	}
+	if err := mapstructure.Decode(ext, instances); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", compose.ExtensionEC2, err)
+	}
+	if instances.InstanceType == "" {
+		return nil, fmt.Errorf("%s requires an instance_type", compose.ExtensionEC2)
+	}
+	if instances.Max == 0 {
+		instances.Max = instances.Count
+	}
+	if instances.Count < 1 || instances.Max < instances.Count {
+		return nil, fmt.Errorf("%s count must be positive and lower than max", compose.ExtensionEC2)
+	}
+	if _, ok := project.Extensions[compose.ExtensionCapacityProviderStrategy]; ok {
+		return nil, fmt.Errorf("%s can't be used with %s", compose.ExtensionCapacityProviderStrategy, compose.ExtensionEC2)
+	}
+	if _, ok := project.Extensions[compose.ExtensionCluster]; ok {
+		// services can only use the instances capacity provider once associated with the cluster, which replaces all
+		// the capacity providers and default strategy of an existing cluster, shared with other workloads
+		return nil, fmt.Errorf("%s can't be used with %s, its capacity provider can only be associated with a cluster created for the project", compose.ExtensionEC2, compose.ExtensionCluster)
+	}
+	for _, service := range project.Services {
+		if _, ok := service.Extensions[compose.ExtensionCapacityProviderStrategy]; ok {
+			return nil, fmt.Errorf("service %s: %s can't be used with %s", service.Name, compose.ExtensionCapacityProviderStrategy, compose.ExtensionEC2)
+		}
+	}
+	if err := checkGPUCapacity(project, instances); err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// getGPUs returns the number of GPUs a service reserves as devices with the gpu capability, by count or device IDs.
+// GPUs reserved as a gpu generic resource are counted as well, as they were before compose-go loaded devices.
+func getGPUs(service types.ServiceConfig) int {
+	if service.Deploy == nil || service.Deploy.Resources.Reservations == nil {
+		return 0
+	}
+	gpus := 0
+	for _, d := range service.Deploy.Resources.Reservations.Devices {
+		if !contains(d.Capabilities, "gpu") {
+			continue
+		}
+		if d.Count > 0 {
+			gpus += int(d.Count)
+		} else {
+			gpus += len(d.IDs)
+		}
+	}
+	for _, r := range service.Deploy.Resources.Reservations.GenericResources {
+		if r.DiscreteResourceSpec != nil && strings.EqualFold(r.DiscreteResourceSpec.Kind, "gpu") {
+			gpus += int(r.DiscreteResourceSpec.Value)
+		}
+	}
+	return gpus
+}
+
+// usesGPUs tells if any service of the project reserves GPUs
+func usesGPUs(project *types.Project) bool {
+	for _, service := range project.Services {
+		if getGPUs(service) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGPUCapacity checks each task, including its sidecar containers, can be placed on an instance according to the
+// GPUs it reserves. Instance types which are not listed as GPU instances are only checked to be in a GPU family
+func checkGPUCapacity(project *types.Project, instances *ec2Instances) error {
+	tasks := map[string]int{}
+	for _, service := range project.Services {
+		task := service.Name
+		if parent := sidecarOf(service); parent != "" {
+			task = parent
+		}
+		tasks[task] += getGPUs(service)
+	}
+	family := strings.SplitN(instances.InstanceType, ".", 2)[0]
+	names := []string{}
+	for task := range tasks {
+		names = append(names, task)
+	}
+	sort.Strings(names)
+	for _, task := range names {
+		gpus := tasks[task]
+		if gpus == 0 {
+			continue
+		}
+		available, ok := gpuInstanceTypes[instances.InstanceType]
+		if !ok {
+			for t := range gpuInstanceTypes {
+				if strings.HasPrefix(t, family+".") {
+					ok = true
+				}
+			}
+			if !ok {
+				return fmt.Errorf("service %s reserves %d GPUs, but %s instances have none", task, gpus, instances.InstanceType)
+			}
+			continue
+		}
+		if gpus > available {
+			return fmt.Errorf("service %s reserves %d GPUs, but %s instances only have %d", task, gpus, instances.InstanceType, available)
+		}
+	}
+	return nil
+}
+
+// createEC2Instances creates an Auto Scaling group of ECS-optimized instances registered to the cluster, and a
+// capacity provider for services to run on those
+func createEC2Instances(project *types.Project, template *cloudformation.Template, instances *ec2Instances, cluster string, securityGroups []string) {
+	ami := ECSOptimizedAMI
+	if usesGPUs(project) {
+		ami = ECSOptimizedGPUAMI
+	}
+	template.Parameters[ParameterEC2InstanceAMI] = cloudformation.Parameter{
+		Type:        "AWS::SSM::Parameter::Value<AWS::EC2::Image::Id>",
+		Description: "ECS-optimized AMI used by EC2 instances",
+		Default:     ami,
+	}
+
+	template.Resources["EC2InstanceRole"] = &iam.Role{
+		AssumeRolePolicyDocument: assumeRolePolicy("ec2.amazonaws.com"),
+		ManagedPolicyArns: []string{
+			ECSInstancePolicy,
+		},
+	}
+	template.Resources["EC2InstanceProfile"] = &iam.InstanceProfile{
+		Roles: []string{
+			cloudformation.Ref("EC2InstanceRole"),
+		},
+	}
+
+	template.Resources["EC2LaunchTemplate"] = &ec2.LaunchTemplate{
+		LaunchTemplateData: &ec2.LaunchTemplate_LaunchTemplateData{
+			IamInstanceProfile: &ec2.LaunchTemplate_IamInstanceProfile{
+				Arn: cloudformation.GetAtt("EC2InstanceProfile", "Arn"),
+			},
+			ImageId:          cloudformation.Ref(ParameterEC2InstanceAMI),
+			InstanceType:     instances.InstanceType,
+			SecurityGroupIds: securityGroups,
+			UserData: cloudformation.Base64(cloudformation.Join("", []string{
+				"#!/bin/bash\necho ECS_CLUSTER=",
+				cluster,
+				" >> /etc/ecs/ecs.config\n",
+			})),
+		},
+	}
+
+	template.Resources["EC2AutoScalingGroup"] = &autoscaling.AutoScalingGroup{
+		DesiredCapacity: strconv.Itoa(instances.Count),
+		LaunchTemplate: &autoscaling.AutoScalingGroup_LaunchTemplateSpecification{
+			LaunchTemplateId: cloudformation.Ref("EC2LaunchTemplate"),
+			Version:          cloudformation.GetAtt("EC2LaunchTemplate", "LatestVersionNumber"),
+		},
+		MaxSize: strconv.Itoa(instances.Max),
+		MinSize: strconv.Itoa(instances.Count),
+		Tags: []autoscaling.AutoScalingGroup_TagProperty{
+			{
+				Key:               compose.ProjectTag,
+				PropagateAtLaunch: true,
+				Value:             project.Name,
+			},
+		},
+		VPCZoneIdentifier: []string{cloudformation.Ref(ParameterSubnetIds)},
+	}
+
+	template.Resources[EC2CapacityProvider] = &ecs.CapacityProvider{
+		AutoScalingGroupProvider: &ecs.CapacityProvider_AutoScalingGroupProvider{
+			AutoScalingGroupArn: cloudformation.Ref("EC2AutoScalingGroup"),
+			ManagedScaling: &ecs.CapacityProvider_ManagedScaling{
+				Status:         ecsapi.ManagedScalingStatusEnabled,
+				TargetCapacity: 100,
+			},
+			ManagedTerminationProtection: ecsapi.ManagedTerminationProtectionDisabled,
+		},
+		Tags: []tags.Tag{
+			{
+				Key:   compose.ProjectTag,
+				Value: project.Name,
+			},
+		},
+	}
+
+	// associations replace the capacity providers of the cluster, so they're only set on the cluster the stack owns
+	template.Resources[EC2CapacityProviderAssociation] = &ecs.ClusterCapacityProviderAssociations{
+		AWSCloudFormationCondition: "CreateCluster",
+		CapacityProviders: []string{
+			cloudformation.Ref(EC2CapacityProvider),
+		},
+		Cluster: cluster,
+		DefaultCapacityProviderStrategy: []ecs.ClusterCapacityProviderAssociations_CapacityProviderStrategy{
+			{
+				CapacityProvider: cloudformation.Ref(EC2CapacityProvider),
+				Weight:           1,
+			},
+		},
+	}
+}
+
+// toPlacementStrategies converts deploy placement preferences into ECS spread placement strategies
+func toPlacementStrategies(deploy *types.DeployConfig) []ecs.Service_PlacementStrategy {
+	if deploy == nil || len(deploy.Placement.Preferences) == 0 {
+		return nil
+	}
+	strategies := []ecs.Service_PlacementStrategy{}
+	for _, p := range deploy.Placement.Preferences {
+		field, ok := toPlacementField(p.Spread)
+		if !ok {
+			continue
+		}
+		strategies = append(strategies, ecs.Service_PlacementStrategy{
+			Field: field,
+			Type:  ecsapi.PlacementStrategyTypeSpread,
+		})
+	}
+	return strategies
+}
+
+// placementConstraint matches the compose placement constraints which have an ECS equivalent
+var placementConstraint = regexp.MustCompile(`^\s*(node\.labels\.[^\s=!]+|node\.platform\.os|node\.platform\.arch)\s*(==|!=)\s*(\S+)\s*$`)
+
+// toPlacementExpression converts a compose placement constraint into an ECS cluster query expression. Node labels are
+// matched against the custom attributes of the container instances, node platform against the ECS built-in
+// attributes, and expressions using the ECS syntax are kept as is.
+func toPlacementExpression(constraint string) (string, bool) {
+	if strings.HasPrefix(constraint, "attribute:") {
+		return constraint, true
+	}
+	match := placementConstraint.FindStringSubmatch(constraint)
+	if match == nil {
+		return "", false
+	}
+	field, operator, value := match[1], match[2], match[3]
+	switch field {
+	case "node.platform.os":
+		field = "attribute:ecs.os-type"
+	case "node.platform.arch":
+		field = "attribute:ecs.cpu-architecture"
+		if value == "aarch64" {
+			value = "arm64"
+		}
+	default:
+		field = "attribute:" + strings.TrimPrefix(field, "node.labels.")
+	}
+	return fmt.Sprintf("%s %s %s", field, operator, value), true
+}
+
+// toPlacementField converts a compose placement preference into the field of an ECS spread placement strategy. Node
+// labels are the custom attributes of the container instances, ECS fields are kept as is.
+func toPlacementField(spread string) (string, bool) {
+	switch {
+	case spread == "instanceId", spread == "host", strings.HasPrefix(spread, "attribute:"):
+		return spread, true
+	case strings.HasPrefix(spread, "node.labels.") && len(spread) > len("node.labels."):
+		return "attribute:" + strings.TrimPrefix(spread, "node.labels."), true
+	}
+	return "", false
+}
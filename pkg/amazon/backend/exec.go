@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/compose-spec/compose-go/cli"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+)
+
+// Exec runs a command within a running container of a service, through an ECS Exec session which data channel
+// streams the standard input and output of the command.
+func (b *Backend) Exec(ctx context.Context, options *cli.ProjectOptions, name string, command []string) error {
+	project, err := cli.ProjectFromOptions(options)
+	if err != nil {
+		return err
+	}
+	service, err := project.GetService(name)
+	if err != nil {
+		return err
+	}
+	task := service.Name
+	if parent := sidecarOf(service); parent != "" {
+		// sidecar containers run within their parent service task
+		task = parent
+	}
+	parent, err := project.GetService(task)
+	if err != nil {
+		return err
+	}
+	sidecars, err := getSidecars(project)
+	if err != nil {
+		return err
+	}
+	enabled, err := usesExec(append([]types.ServiceConfig{parent}, sidecars[task]...))
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return fmt.Errorf("service %s doesn't enable ECS Exec, set %s: true and update the stack", task, compose.ExtensionExec)
+	}
+
+	resources, err := b.getStackResources(ctx, project.Name, true)
+	if err != nil {
+		return err
+	}
+	parameters, err := b.api.ListStackParameters(ctx, project.Name)
+	if err != nil {
+		return err
+	}
+	cluster := getClusterName(parameters, resources)
+
+	arn, err := b.getExecTask(ctx, project, cluster, resources, task, service.Name)
+	if err != nil {
+		return err
+	}
+
+	cmd := "/bin/sh"
+	if len(command) > 0 {
+		cmd = quoteCommand(command)
+	}
+	session, err := b.api.ExecuteCommand(ctx, cluster, arn, service.Name, cmd)
+	if err != nil {
+		return err
+	}
+
+	s, err := openExecSession(ctx, session)
+	if err != nil {
+		return err
+	}
+	return s.run(ctx, os.Stdin, os.Stdout)
+}
+
+// getExecTask selects a running task of a service which container can open an ECS Exec session, returning the task
+// ARN. Tasks are listed by service, so one-off tasks of the same task definition family run by compose run aren't
+// selected.
+func (b *Backend) getExecTask(ctx context.Context, project *types.Project, cluster string, resources map[string]string, task string, container string) (string, error) {
+	serviceARN, ok := resources[serviceResourceName(project, task)]
+	if !ok {
+		return "", fmt.Errorf("service %s has not been deployed", task)
+	}
+	arns, err := b.api.ListTasks(ctx, cluster, serviceARN[strings.LastIndex(serviceARN, "/")+1:])
+	if err != nil {
+		return "", err
+	}
+	if len(arns) == 0 {
+		return "", fmt.Errorf("service %s has no running task", task)
+	}
+	tasks, err := b.api.DescribeTasks(ctx, cluster, arns...)
+	if err != nil {
+		return "", err
+	}
+	running := false
+	for _, t := range tasks {
+		if t.Status != ecsapi.DesiredStatusRunning {
+			continue
+		}
+		for _, c := range t.Containers {
+			if c.Name != container || c.RuntimeID == "" {
+				continue
+			}
+			running = true
+			if c.ExecuteCommandAgent == ecsapi.DesiredStatusRunning {
+				return t.ARN, nil
+			}
+		}
+	}
+	if !running {
+		return "", fmt.Errorf("container %s is not running", container)
+	}
+	return "", fmt.Errorf("ECS Exec agent is not running in container %s, tasks started before %s was enabled have to be replaced", container, compose.ExtensionExec)
+}
+
+// usesExec tells if x-aws-exec enables ECS Exec on a task, set on its service or any of its sidecar containers
+func usesExec(containers []types.ServiceConfig) (bool, error) {
+	enabled := false
+	for _, container := range containers {
+		v, ok := container.Extensions[compose.ExtensionExec]
+		if !ok {
+			continue
+		}
+		exec, ok := v.(bool)
+		if !ok {
+			return false, fmt.Errorf("service %s: %s must be a boolean", container.Name, compose.ExtensionExec)
+		}
+		enabled = enabled || exec
+	}
+	return enabled, nil
+}
+
+var unquotedArgument = regexp.MustCompile(`^[a-zA-Z0-9_@%+=:,./-]+$`)
+
+// quoteCommand joins command arguments into the command line ECS Exec runs, which the SSM agent splits back into
+// arguments as a POSIX shell would
+func quoteCommand(command []string) string {
+	args := make([]string, len(command))
+	for i, arg := range command {
+		if unquotedArgument.MatchString(arg) {
+			args[i] = arg
+			continue
+		}
+		args[i] = "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+	}
+	return strings.Join(args, " ")
+}
@@ -0,0 +1,120 @@
+package backend
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/awslabs/goformation/v4/cloudformation/elasticloadbalancingv2"
+	cloudmap "github.com/awslabs/goformation/v4/cloudformation/servicediscovery"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+)
+
+// loadBalancerHealthCheck is the content of the x-aws-healthcheck extension
+type loadBalancerHealthCheck struct {
+	Path    string `mapstructure:"path"`
+	Matcher string `mapstructure:"matcher"`
+	Port    int    `mapstructure:"port"`
+}
+
+func getLoadBalancerHealthCheck(service types.ServiceConfig) (*loadBalancerHealthCheck, error) {
+	ext, ok := service.Extensions[compose.ExtensionHealthCheck]
+	if !ok {
+		return nil, nil
+	}
+	healthCheck := &loadBalancerHealthCheck{}
+	if err := mapstructure.Decode(ext, healthCheck); err != nil {
+		return nil, fmt.Errorf("service %s: invalid %s: %s", service.Name, compose.ExtensionHealthCheck, err)
+	}
+	return healthCheck, nil
+}
+
+// setTargetGroupHealthCheck configures the target group health check to match the service healthcheck, so the load
+// balancer doesn't rely on defaults which don't match the application.
+func setTargetGroupHealthCheck(targetGroup *elasticloadbalancingv2.TargetGroup, service types.ServiceConfig, healthCheck *loadBalancerHealthCheck, loadBalancerType string) {
+	network := loadBalancerType == elbv2.LoadBalancerTypeEnumNetwork
+	if healthCheck != nil {
+		if healthCheck.Path != "" {
+			targetGroup.HealthCheckPath = healthCheck.Path
+			targetGroup.HealthCheckProtocol = elbv2.ProtocolEnumHttp
+		}
+		if healthCheck.Matcher != "" {
+			if network {
+				logrus.Warnf("service %s: network load balancer doesn't support custom health check matcher", service.Name)
+			} else {
+				targetGroup.Matcher = &elasticloadbalancingv2.TargetGroup_Matcher{
+					HttpCode: healthCheck.Matcher,
+				}
+			}
+		}
+		if healthCheck.Port != 0 {
+			targetGroup.HealthCheckPort = strconv.Itoa(healthCheck.Port)
+		}
+	}
+
+	check := service.HealthCheck
+	if check == nil || check.Disable {
+		return
+	}
+	interval := durationToInt(check.Interval)
+	if network {
+		// network load balancer only accept 10 or 30 seconds intervals
+		if interval > 0 && interval <= 10 {
+			interval = 10
+		} else if interval > 10 {
+			interval = 30
+		}
+	} else if interval > 0 {
+		interval = clamp(interval, 5, 300)
+	}
+	targetGroup.HealthCheckIntervalSeconds = interval
+
+	if check.Retries != nil {
+		threshold := clamp(int(*check.Retries), 2, 10)
+		targetGroup.UnhealthyThresholdCount = threshold
+		if network {
+			// network load balancer require healthy and unhealthy thresholds to be equal
+			targetGroup.HealthyThresholdCount = threshold
+		}
+	}
+
+	timeout := durationToInt(check.Timeout)
+	if timeout > 0 && !network {
+		if interval == 0 {
+			interval = 30 // target group default
+		}
+		// timeout must be lower than interval
+		targetGroup.HealthCheckTimeoutSeconds = clamp(timeout, 2, min(interval-1, 120))
+	}
+}
+
+// getServiceRegistryHealthCheck returns the Cloud Map health check of a service. Cloud Map HealthCheckConfig relies on
+// Route 53 health checks, which only apply to public DNS namespaces: services are registered in the private
+// <project>.local namespace, so the health check is a custom one, which ECS updates with the status of the tasks
+// according to the service healthcheck, and unhealthy tasks get deregistered.
+func getServiceRegistryHealthCheck() *cloudmap.Service_HealthCheckCustomConfig {
+	return &cloudmap.Service_HealthCheckCustomConfig{
+		// Cloud Map only supports a threshold of 1 for custom health checks
+		FailureThreshold: 1,
+	}
+}
+
+func clamp(value, lower, upper int) int {
+	if value < lower {
+		return lower
+	}
+	if value > upper {
+		return upper
+	}
+	return value
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -3,23 +3,48 @@ package backend
 const (
 	ECSTaskExecutionPolicy = "arn:aws:iam::aws:policy/service-role/AmazonECSTaskExecutionRolePolicy"
 	ECRReadOnlyPolicy      = "arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly"
+	ECSInstancePolicy      = "arn:aws:iam::aws:policy/service-role/AmazonEC2ContainerServiceforEC2Role"
+	CodeDeployECSPolicy    = "arn:aws:iam::aws:policy/AWSCodeDeployRoleForECS"
+	ECSEventsPolicy        = "arn:aws:iam::aws:policy/service-role/AmazonEC2ContainerServiceEventsRole"
+
+	LambdaBasicExecutionPolicy = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
 
 	ActionGetSecretValue = "secretsmanager:GetSecretValue"
 	ActionGetParameters  = "ssm:GetParameters"
 	ActionDecrypt        = "kms:Decrypt"
+
+	ActionDescribeServices = "ecs:DescribeServices"
+	ActionUpdateService    = "ecs:UpdateService"
+	ActionDescribeAlarms   = "cloudwatch:DescribeAlarms"
+	ActionPutMetricAlarm   = "cloudwatch:PutMetricAlarm"
+	ActionDeleteAlarms     = "cloudwatch:DeleteAlarms"
+
+	ActionListTasks            = "ecs:ListTasks"
+	ActionDescribeTasks        = "ecs:DescribeTasks"
+	ActionDescribeTargetHealth = "elasticloadbalancing:DescribeTargetHealth"
+
+	ActionCreateControlChannel = "ssmmessages:CreateControlChannel"
+	ActionCreateDataChannel    = "ssmmessages:CreateDataChannel"
+	ActionOpenControlChannel   = "ssmmessages:OpenControlChannel"
+	ActionOpenDataChannel      = "ssmmessages:OpenDataChannel"
 )
 
-var assumeRolePolicyDocument = PolicyDocument{
-	Version: "2012-10-17", // https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_policies_elements_version.html
-	Statement: []PolicyStatement{
-		{
-			Effect: "Allow",
-			Principal: PolicyPrincipal{
-				Service: "ecs-tasks.amazonaws.com",
+var assumeRolePolicyDocument = assumeRolePolicy("ecs-tasks.amazonaws.com")
+
+// assumeRolePolicy lets the AWS service principal assume a role
+func assumeRolePolicy(service string) PolicyDocument {
+	return PolicyDocument{
+		Version: "2012-10-17", // https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_policies_elements_version.html
+		Statement: []PolicyStatement{
+			{
+				Effect: "Allow",
+				Principal: PolicyPrincipal{
+					Service: service,
+				},
+				Action: []string{"sts:AssumeRole"},
 			},
-			Action: []string{"sts:AssumeRole"},
 		},
-	},
+	}
 }
 
 // could alternatively depend on https://github.com/kubernetes-sigs/cluster-api-provider-aws/blob/master/cmd/clusterawsadm/api/iam/v1alpha1/types.go
@@ -0,0 +1,195 @@
+package backend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation"
+	"github.com/awslabs/goformation/v4/cloudformation/lambda"
+	"github.com/awslabs/goformation/v4/cloudformation/logs"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/mitchellh/mapstructure"
+)
+
+// logsSubscription is the content of the x-aws-logs_subscription extension, which streams a log group to a Kinesis
+// stream, a Kinesis Data Firehose delivery stream or a Lambda function
+type logsSubscription struct {
+	Destination   string `mapstructure:"destination"`
+	FilterPattern string `mapstructure:"filter_pattern"`
+	// Role lets CloudWatch Logs put records into a Kinesis destination
+	Role string `mapstructure:"role"`
+}
+
+// logsExtensions are the extensions which, set on a service, give it a dedicated log group
+var logsExtensions = []string{
+	compose.ExtensionRetention,
+	compose.ExtensionLogsKMSKey,
+	compose.ExtensionLogsSubscription,
+}
+
+// logsOptions are the awslogs logging options which, as the extensions they map to, give a service a dedicated log
+// group. The awslogs driver doesn't know them, so they aren't passed to the container log configuration.
+var logsOptions = map[string]string{
+	"retention": compose.ExtensionRetention,
+	"kms_key":   compose.ExtensionLogsKMSKey,
+}
+
+// hasLogGroup tells if a service logs to a dedicated log group rather than the project one
+func hasLogGroup(service types.ServiceConfig) bool {
+	for _, ext := range logsExtensions {
+		if _, ok := service.Extensions[ext]; ok {
+			return true
+		}
+	}
+	for option := range getLogsOptions(service) {
+		if _, ok := logsOptions[option]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getLogsOptions returns the logging options of a service which logs with the awslogs driver
+func getLogsOptions(service types.ServiceConfig) map[string]string {
+	if service.Logging == nil || (service.Logging.Driver != "" && service.Logging.Driver != ecsapi.LogDriverAwslogs) {
+		return nil
+	}
+	return service.Logging.Options
+}
+
+// getLogGroupSettings returns the extensions configuring the log group of a service, set by its x-aws-logs_*
+// extensions or, unless those are set, its logging options
+func getLogGroupSettings(service types.ServiceConfig) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	for option, value := range getLogsOptions(service) {
+		ext, ok := logsOptions[option]
+		if !ok {
+			continue
+		}
+		if ext != compose.ExtensionRetention {
+			settings[ext] = value
+			continue
+		}
+		retention, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid logging option %s: %q is not a number of days", option, value)
+		}
+		settings[ext] = retention
+	}
+	for _, ext := range logsExtensions {
+		if v, ok := service.Extensions[ext]; ok {
+			settings[ext] = v
+		}
+	}
+	return settings, nil
+}
+
+func logGroupResourceName(project *types.Project, service types.ServiceConfig) string {
+	if !hasLogGroup(service) {
+		return "LogGroup"
+	}
+	return fmt.Sprintf("%sLogGroup", serviceLogicalName(project, service.Name))
+}
+
+// logGroupName is the log group service containers log to. Service log groups share the project prefix, so logs
+// can be collected across all of them
+func logGroupName(project *types.Project, service types.ServiceConfig) string {
+	if !hasLogGroup(service) {
+		return fmt.Sprintf("/docker-compose/%s", project.Name)
+	}
+	return fmt.Sprintf("/docker-compose/%s/%s", project.Name, service.Name)
+}
+
+// containerLogGroup is the log group a container of the project logs to, the FireLens log router using the
+// project one
+func containerLogGroup(project *types.Project, container string) string {
+	for _, service := range project.Services {
+		if container == service.Name || container == secretsInitContainerName(project, service) {
+			return logGroupName(project, service)
+		}
+	}
+	return fmt.Sprintf("/docker-compose/%s", project.Name)
+}
+
+// createLogGroups creates the project log group, and a log group for each service which sets its own retention,
+// encryption key or subscription
+func createLogGroups(project *types.Project, template *cloudformation.Template) error {
+	err := createLogGroup(template, "LogGroup", fmt.Sprintf("/docker-compose/%s", project.Name), project.Extensions)
+	if err != nil {
+		return err
+	}
+	for _, service := range project.Services {
+		if !hasLogGroup(service) {
+			continue
+		}
+		settings, err := getLogGroupSettings(service)
+		if err != nil {
+			return fmt.Errorf("service %s: %s", service.Name, err)
+		}
+		err = createLogGroup(template, logGroupResourceName(project, service), logGroupName(project, service), settings)
+		if err != nil {
+			return fmt.Errorf("service %s: %s", service.Name, err)
+		}
+	}
+	return nil
+}
+
+// createLogGroup creates a log group configured by the x-aws-logs_* extensions. A KMS key used for encryption must
+// allow the CloudWatch Logs service principal to use it
+func createLogGroup(template *cloudformation.Template, resource string, name string, extensions map[string]interface{}) error {
+	retention := 0
+	if v, ok := extensions[compose.ExtensionRetention]; ok {
+		if retention, ok = v.(int); !ok {
+			return fmt.Errorf("%s must be a number of days", compose.ExtensionRetention)
+		}
+	}
+	kmsKey := ""
+	if v, ok := extensions[compose.ExtensionLogsKMSKey]; ok {
+		if kmsKey, ok = v.(string); !ok || kmsKey == "" {
+			return fmt.Errorf("%s must be the ARN or ID of a KMS key", compose.ExtensionLogsKMSKey)
+		}
+	}
+	template.Resources[resource] = &logs.LogGroup{
+		KmsKeyId:        kmsKey,
+		LogGroupName:    name,
+		RetentionInDays: retention,
+	}
+
+	ext, ok := extensions[compose.ExtensionLogsSubscription]
+	if !ok {
+		return nil
+	}
+	subscription := logsSubscription{}
+	if err := mapstructure.Decode(ext, &subscription); err != nil {
+		return fmt.Errorf("invalid %s: %s", compose.ExtensionLogsSubscription, err)
+	}
+	if subscription.Destination == "" {
+		return fmt.Errorf("%s requires a destination", compose.ExtensionLogsSubscription)
+	}
+	dependsOn := []string{}
+	switch {
+	case strings.Contains(subscription.Destination, ":lambda:"):
+		// CloudWatch Logs must be allowed to invoke the function
+		permission := fmt.Sprintf("%sSubscriptionPermission", resource)
+		template.Resources[permission] = &lambda.Permission{
+			Action:       "lambda:InvokeFunction",
+			FunctionName: subscription.Destination,
+			Principal:    "logs.amazonaws.com",
+			SourceArn:    cloudformation.GetAtt(resource, "Arn"),
+		}
+		dependsOn = append(dependsOn, permission)
+	case subscription.Role == "":
+		return fmt.Errorf("%s requires a role to stream logs to %s", compose.ExtensionLogsSubscription, subscription.Destination)
+	}
+	template.Resources[fmt.Sprintf("%sSubscriptionFilter", resource)] = &logs.SubscriptionFilter{
+		AWSCloudFormationDependsOn: dependsOn,
+		DestinationArn:             subscription.Destination,
+		FilterPattern:              subscription.FilterPattern,
+		LogGroupName:               cloudformation.Ref(resource),
+		RoleArn:                    subscription.Role,
+	}
+	return nil
+}
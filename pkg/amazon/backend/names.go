@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/awslabs/goformation/v4/cloudformation"
+	"github.com/compose-spec/compose-go/types"
+)
+
+// NameHashLength is the number of hexadecimal characters of the hash which tells apart names converting into the
+// same logical ID
+const NameHashLength = 7
+
+// logicalName converts a compose name into the prefix of the logical IDs of the resources created for it. Logical IDs
+// are alphanumeric, so names only differing by other characters or case, like my-api and myapi, would overwrite each
+// other's resources. Among colliding names, an alphanumeric one keeps its logical ID, so it doesn't change when a
+// colliding name is added to the project, while the other ones get a suffix hashed from the original name to keep
+// them apart. Names which don't collide never get a suffix.
+func logicalName(name string, names []string) string {
+	normalized := normalizeResourceName(name)
+	if normalized == "" {
+		return nameHash(name)
+	}
+	colliding := []string{}
+	for _, other := range names {
+		if other != name && normalizeResourceName(other) == normalized {
+			colliding = append(colliding, other)
+		}
+	}
+	if len(colliding) == 0 || name == keeperName(normalized, append(colliding, name)) {
+		return normalized
+	}
+	return normalized + nameHash(name)
+}
+
+// keeperName returns the name which keeps the logical ID names collide on: the alphanumeric name already equal to
+// the logical ID, like Myapi rather than myapi, or else the lexically first alphanumeric one
+func keeperName(logicalID string, names []string) string {
+	keeper := ""
+	for _, name := range names {
+		if !isAlphanumeric(name) {
+			continue
+		}
+		if name == logicalID {
+			return name
+		}
+		if keeper == "" || name < keeper {
+			keeper = name
+		}
+	}
+	return keeper
+}
+
+var alphanumericName = regexp.MustCompile("^[a-zA-Z0-9]+$")
+
+func isAlphanumeric(name string) bool {
+	return alphanumericName.MatchString(name)
+}
+
+func nameHash(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])[:NameHashLength]
+}
+
+func serviceLogicalName(project *types.Project, service string) string {
+	return logicalName(service, project.ServiceNames())
+}
+
+func networkLogicalName(project *types.Project, network string) string {
+	return logicalName(network, project.NetworkNames())
+}
+
+func volumeLogicalName(project *types.Project, volume string) string {
+	return logicalName(volume, project.VolumeNames())
+}
+
+func secretLogicalName(project *types.Project, secret string) string {
+	return logicalName(secret, project.SecretNames())
+}
+
+// checkLogicalNames returns an error if the services, networks, volumes or secrets of a project can't be converted
+// into distinct logical IDs, even with a hash suffix
+func checkLogicalNames(project *types.Project) error {
+	for _, kind := range []struct {
+		name  string
+		names []string
+	}{
+		{"service", project.ServiceNames()},
+		{"network", project.NetworkNames()},
+		{"volume", project.VolumeNames()},
+		{"secret", project.SecretNames()},
+	} {
+		sort.Strings(kind.names)
+		known := map[string]string{}
+		for _, name := range kind.names {
+			logical := logicalName(name, kind.names)
+			if other, ok := known[logical]; ok {
+				return fmt.Errorf("%s names %q and %q can't be converted into distinct CloudFormation logical IDs", kind.name, other, name)
+			}
+			known[logical] = name
+		}
+	}
+	return nil
+}
+
+// addResource adds a resource to a template, unless its logical ID is already used. Logical IDs derived from several
+// names, like listener rules named after a service and a port, can collide with another resource's, which would
+// otherwise be silently overwritten.
+func addResource(template *cloudformation.Template, name string, resource cloudformation.Resource) error {
+	if _, ok := template.Resources[name]; ok {
+		return fmt.Errorf("resource %s can't be created, its CloudFormation logical ID is already used", name)
+	}
+	template.Resources[name] = resource
+	return nil
+}
@@ -0,0 +1,291 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/awslabs/goformation/v4/cloudformation"
+	"github.com/awslabs/goformation/v4/cloudformation/elasticloadbalancingv2"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/mitchellh/mapstructure"
+)
+
+// routing is the content of the x-aws-routing extension
+type routing struct {
+	Paths    []string `mapstructure:"paths"`
+	Hosts    []string `mapstructure:"hosts"`
+	Priority int      `mapstructure:"priority"`
+}
+
+func getRouting(service types.ServiceConfig) (*routing, error) {
+	ext, ok := service.Extensions[compose.ExtensionRouting]
+	if !ok {
+		return nil, nil
+	}
+	r := &routing{}
+	if err := mapstructure.Decode(ext, r); err != nil {
+		return nil, fmt.Errorf("service %s: invalid %s: %s", service.Name, compose.ExtensionRouting, err)
+	}
+	if len(r.Paths) == 0 && len(r.Hosts) == 0 {
+		return nil, fmt.Errorf("service %s: %s requires paths or hosts", service.Name, compose.ExtensionRouting)
+	}
+	if r.Priority < 0 || r.Priority > 50000 {
+		return nil, fmt.Errorf("service %s: %s priority must be 0 (automatic) or between 1 and 50000, got %d", service.Name, compose.ExtensionRouting, r.Priority)
+	}
+	return r, nil
+}
+
+// listener collects the services published on a load balancer port, so they can share a single listener
+type listener struct {
+	protocol     string
+	port         int
+	certificates []string
+	// defaultService is the service receiving requests which don't match any rule
+	defaultService     string
+	defaultTargetGroup string
+	rules              []listenerRule
+}
+
+type listenerRule struct {
+	name        string
+	service     string
+	targetGroup string
+	routing     *routing
+}
+
+// listeners indexes shared listeners by resource name
+type listeners map[string]*listener
+
+// add registers a service target group on the listener for port, and returns the resource the service has to depend
+// on so the target group is associated with the load balancer before the service is created
+func (l listeners) add(project *types.Project, service types.ServiceConfig, port types.ServicePortConfig, protocol string, certificate string, targetGroupName string, r *routing) (string, error) {
+	listenerName := listenerResourceName(project, protocol, port)
+	shared, ok := l[listenerName]
+	if !ok {
+		shared = &listener{
+			protocol: protocol,
+			port:     int(publishedPort(port)),
+		}
+		l[listenerName] = shared
+	}
+	if certificate != "" && !contains(shared.certificates, certificate) {
+		shared.certificates = append(shared.certificates, certificate)
+	}
+
+	if r == nil {
+		if shared.defaultService != "" && shared.defaultService != service.Name {
+			return "", fmt.Errorf("services %s and %s both publish port %d without %s", shared.defaultService, service.Name, publishedPort(port), compose.ExtensionRouting)
+		}
+		shared.defaultService = service.Name
+		shared.defaultTargetGroup = targetGroupName
+		return listenerName, nil
+	}
+
+	if protocol != elbv2.ProtocolEnumHttp && protocol != elbv2.ProtocolEnumHttps {
+		return "", fmt.Errorf("service %s: %s is only supported by application load balancer", service.Name, compose.ExtensionRouting)
+	}
+	ruleName := fmt.Sprintf("%s%s%dListenerRule", serviceLogicalName(project, service.Name), protocol, publishedPort(port))
+	shared.rules = append(shared.rules, listenerRule{
+		name:        ruleName,
+		service:     service.Name,
+		targetGroup: targetGroupName,
+		routing:     r,
+	})
+	return ruleName, nil
+}
+
+// listenerResourceName returns the logical ID of the listener on a published port. A port published by a single
+// service keeps the <Service><PROTOCOL><port>Listener ID listeners had before they could be shared, so stacks
+// deployed by previous versions get their listener updated rather than replaced, which would fail as the new listener
+// conflicts with the existing one on the same port.
+func listenerResourceName(project *types.Project, protocol string, port types.ServicePortConfig) string {
+	publishers := []string{}
+	for _, service := range project.Services {
+		for _, p := range service.Ports {
+			if publishedPort(p) == publishedPort(port) && !contains(publishers, service.Name) {
+				publishers = append(publishers, service.Name)
+			}
+		}
+	}
+	if len(publishers) == 1 {
+		return fmt.Sprintf("%s%s%dListener", serviceLogicalName(project, publishers[0]), strings.ToUpper(port.Protocol), publishedPort(port))
+	}
+	return fmt.Sprintf("%s%dListener", protocol, publishedPort(port))
+}
+
+// createListeners adds the shared listeners and their rules to the template
+func (l listeners) createListeners(project *types.Project, template *cloudformation.Template, loadBalancerARN string) error {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := l[name].create(project, template, name, loadBalancerARN); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *listener) create(project *types.Project, template *cloudformation.Template, listenerName string, loadBalancerARN string) error {
+	//add listener to dependsOn
+	//https://stackoverflow.com/questions/53971873/the-target-group-does-not-have-an-associated-load-balancer
+	defaultAction := elasticloadbalancingv2.Listener_Action{
+		// requests which don't match any service routing rule
+		FixedResponseConfig: &elasticloadbalancingv2.Listener_FixedResponseConfig{
+			ContentType: "text/plain",
+			StatusCode:  "404",
+		},
+		Type: elbv2.ActionTypeEnumFixedResponse,
+	}
+	if l.defaultTargetGroup != "" {
+		defaultAction = elasticloadbalancingv2.Listener_Action{
+			ForwardConfig: &elasticloadbalancingv2.Listener_ForwardConfig{
+				TargetGroups: []elasticloadbalancingv2.Listener_TargetGroupTuple{
+					{
+						TargetGroupArn: cloudformation.Ref(l.defaultTargetGroup),
+					},
+				},
+			},
+			Type: elbv2.ActionTypeEnumForward,
+		}
+	}
+	resource := &elasticloadbalancingv2.Listener{
+		DefaultActions:  []elasticloadbalancingv2.Listener_Action{defaultAction},
+		LoadBalancerArn: loadBalancerARN,
+		Protocol:        l.protocol,
+		Port:            l.port,
+	}
+	if l.protocol == elbv2.ProtocolEnumHttps && len(l.certificates) == 0 {
+		return fmt.Errorf("HTTPS listener on port %d requires %s to be set with an ACM certificate ARN", l.port, compose.ExtensionCertificate)
+	}
+	if len(l.certificates) > 0 {
+		sslPolicy := DefaultSSLPolicy
+		if v, ok := project.Extensions[compose.ExtensionSSLPolicy]; ok {
+			policy, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("%s must be a string", compose.ExtensionSSLPolicy)
+			}
+			sslPolicy = policy
+		}
+		resource.Certificates = []elasticloadbalancingv2.Listener_Certificate{
+			{
+				CertificateArn: l.certificates[0],
+			},
+		}
+		resource.SslPolicy = sslPolicy
+		if len(l.certificates) > 1 {
+			// the listener only accept a default certificate, others are selected using SNI
+			additional := []elasticloadbalancingv2.ListenerCertificate_Certificate{}
+			for _, certificate := range l.certificates[1:] {
+				additional = append(additional, elasticloadbalancingv2.ListenerCertificate_Certificate{
+					CertificateArn: certificate,
+				})
+			}
+			err := addResource(template, fmt.Sprintf("%sCertificates", listenerName), &elasticloadbalancingv2.ListenerCertificate{
+				Certificates: additional,
+				ListenerArn:  cloudformation.Ref(listenerName),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := addResource(template, listenerName, resource); err != nil {
+		return err
+	}
+
+	priorities, err := l.rulePriorities()
+	if err != nil {
+		return err
+	}
+	for _, rule := range l.rules {
+		conditions := []elasticloadbalancingv2.ListenerRule_RuleCondition{}
+		if len(rule.routing.Paths) > 0 {
+			conditions = append(conditions, elasticloadbalancingv2.ListenerRule_RuleCondition{
+				Field: "path-pattern",
+				PathPatternConfig: &elasticloadbalancingv2.ListenerRule_PathPatternConfig{
+					Values: rule.routing.Paths,
+				},
+			})
+		}
+		if len(rule.routing.Hosts) > 0 {
+			conditions = append(conditions, elasticloadbalancingv2.ListenerRule_RuleCondition{
+				Field: "host-header",
+				HostHeaderConfig: &elasticloadbalancingv2.ListenerRule_HostHeaderConfig{
+					Values: rule.routing.Hosts,
+				},
+			})
+		}
+		err := addResource(template, rule.name, &elasticloadbalancingv2.ListenerRule{
+			Actions: []elasticloadbalancingv2.ListenerRule_Action{
+				{
+					ForwardConfig: &elasticloadbalancingv2.ListenerRule_ForwardConfig{
+						TargetGroups: []elasticloadbalancingv2.ListenerRule_TargetGroupTuple{
+							{
+								TargetGroupArn: cloudformation.Ref(rule.targetGroup),
+							},
+						},
+					},
+					Type: elbv2.ActionTypeEnumForward,
+				},
+			},
+			Conditions:  conditions,
+			ListenerArn: cloudformation.Ref(listenerName),
+			Priority:    priorities[rule.name],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rulePriorities assigns a unique priority to each rule. Explicit priorities are kept, others get the lowest free
+// values in service name order so the template is stable across conversions.
+func (l *listener) rulePriorities() (map[string]int, error) {
+	priorities := map[string]int{}
+	used := map[int]string{}
+	for _, rule := range l.rules {
+		p := rule.routing.Priority
+		if p == 0 {
+			continue
+		}
+		if other, ok := used[p]; ok {
+			return nil, fmt.Errorf("services %s and %s use the same %s priority %d on port %d", other, rule.service, compose.ExtensionRouting, p, l.port)
+		}
+		used[p] = rule.service
+		priorities[rule.name] = p
+	}
+
+	rules := make([]listenerRule, len(l.rules))
+	copy(rules, l.rules)
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].name < rules[j].name
+	})
+	next := 1
+	for _, rule := range rules {
+		if rule.routing.Priority != 0 {
+			continue
+		}
+		for used[next] != "" {
+			next++
+		}
+		used[next] = rule.service
+		priorities[rule.name] = next
+	}
+	return priorities, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
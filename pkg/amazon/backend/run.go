@@ -0,0 +1,211 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/compose-spec/compose-go/cli"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/docker/ecs-plugin/pkg/console"
+	"github.com/sirupsen/logrus"
+)
+
+// Run runs a one-off task from the deployed task definition of a service, streams its logs, and returns the exit
+// code of the service container
+func (b *Backend) Run(ctx context.Context, options *cli.ProjectOptions, service string, command []string, writer io.Writer) (int, error) {
+	project, err := cli.ProjectFromOptions(options)
+	if err != nil {
+		return 0, err
+	}
+	task, err := b.getTaskRequest(ctx, project, service)
+	if err != nil {
+		return 0, err
+	}
+	task.Command = command
+
+	arn, err := b.api.RunTask(ctx, task)
+	if err != nil {
+		return 0, err
+	}
+	taskID := arn[strings.LastIndex(arn, "/")+1:]
+
+	consumer := &logConsumer{
+		colors: map[string]console.ColorFunc{},
+		width:  0,
+		writer: writer,
+	}
+	startTimes := map[string]int64{}
+	skipped := map[string]bool{}
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		tasks, err := b.api.DescribeTasks(ctx, task.Cluster, arn)
+		if err != nil {
+			return 0, err
+		}
+		if len(tasks) == 0 {
+			return 0, fmt.Errorf("task %s not found", taskID)
+		}
+		streams := map[string][]string{}
+		for _, container := range tasks[0].Containers {
+			logGroup, stream, err := containerLogStream(project, container.Name, taskID)
+			if err != nil {
+				if !skipped[container.Name] {
+					skipped[container.Name] = true
+					logrus.Info(err.Error())
+				}
+				continue
+			}
+			streams[logGroup] = append(streams[logGroup], stream)
+		}
+		for logGroup, s := range streams {
+			startTimes[logGroup], err = b.api.GetTaskLogs(ctx, logGroup, s, startTimes[logGroup], consumer)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		if tasks[0].Status == ecsapi.DesiredStatusStopped {
+			for _, container := range tasks[0].Containers {
+				if container.Name != task.Container {
+					continue
+				}
+				if container.ExitCode == nil {
+					return 0, fmt.Errorf("task %s stopped: %s %s", taskID, tasks[0].StoppedReason, container.Reason)
+				}
+				return *container.ExitCode, nil
+			}
+			return 0, fmt.Errorf("task %s stopped: %s", taskID, tasks[0].StoppedReason)
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// containerLogStream returns the log group and stream a container of a task logs to, following the awslogs options
+// of its log configuration, or an error if its logs can't be streamed
+func containerLogStream(project *types.Project, container string, taskID string) (string, string, error) {
+	logGroup := containerLogGroup(project, container)
+	prefix := project.Name
+	for _, service := range project.Services {
+		if container != service.Name && container != secretsInitContainerName(project, service) {
+			continue
+		}
+		config, err := getLogConfiguration(service, project)
+		if err != nil {
+			return "", "", err
+		}
+		if config.LogDriver != ecsapi.LogDriverAwslogs {
+			return "", "", fmt.Errorf("container %s logs with the %s driver, its logs can't be streamed", container, config.LogDriver)
+		}
+		if service.Logging != nil && service.Logging.Options["awslogs-group"] != "" {
+			logGroup = service.Logging.Options["awslogs-group"]
+		}
+		prefix = config.Options["awslogs-stream-prefix"]
+	}
+	if prefix == "" {
+		return "", "", fmt.Errorf("container %s logs without awslogs-stream-prefix, its logs can't be streamed", container)
+	}
+	// awslogs names streams prefix/container/task ID
+	return logGroup, fmt.Sprintf("%s/%s/%s", prefix, container, taskID), nil
+}
+
+// getTaskRequest reuses the task definition and network settings a service has been deployed with, to run a task
+func (b *Backend) getTaskRequest(ctx context.Context, project *types.Project, name string) (compose.TaskRequest, error) {
+	service, err := project.GetService(name)
+	if err != nil {
+		return compose.TaskRequest{}, err
+	}
+	task := service
+	if parent := sidecarOf(service); parent != "" {
+		// sidecar containers run within their parent service task
+		task, err = project.GetService(parent)
+		if err != nil {
+			return compose.TaskRequest{}, err
+		}
+	}
+
+	resources, err := b.getStackResources(ctx, project.Name, true)
+	if err != nil {
+		return compose.TaskRequest{}, err
+	}
+	taskDefinition, ok := resources[taskDefinitionResourceName(project, task.Name)]
+	if !ok {
+		return compose.TaskRequest{}, fmt.Errorf("service %s has not been deployed", task.Name)
+	}
+	parameters, err := b.api.ListStackParameters(ctx, project.Name)
+	if err != nil {
+		return compose.TaskRequest{}, err
+	}
+	cluster := getClusterName(parameters, resources)
+
+	securityGroups := []string{}
+	for name, net := range project.Networks {
+		if _, ok := task.Networks[name]; !ok {
+			continue
+		}
+		if sg, ok := net.Extensions[compose.ExtensionSecurityGroup]; ok {
+			securityGroups = append(securityGroups, sg.(string))
+			continue
+		}
+		securityGroups = append(securityGroups, resources[networkResourceName(project, name)])
+	}
+	sort.Strings(securityGroups)
+
+	assignPublicIP, err := getAssignPublicIP(project, task)
+	if err != nil {
+		return compose.TaskRequest{}, err
+	}
+
+	// run the task as the service does
+	launchType, strategy, err := getLaunchType(project, task, resources[EC2CapacityProvider])
+	if err != nil {
+		return compose.TaskRequest{}, err
+	}
+	sidecars, err := getSidecars(project)
+	if err != nil {
+		return compose.TaskRequest{}, err
+	}
+	platformVersion, err := getPlatformVersion(project, append([]types.ServiceConfig{task}, sidecars[task.Name]...))
+	if err != nil {
+		return compose.TaskRequest{}, err
+	}
+	capacityProviders := []compose.CapacityProviderStrategyItem{}
+	for _, item := range strategy {
+		capacityProviders = append(capacityProviders, compose.CapacityProviderStrategyItem{
+			CapacityProvider: item.CapacityProvider,
+			Weight:           item.Weight,
+			Base:             item.Base,
+		})
+	}
+
+	return compose.TaskRequest{
+		Cluster:                  cluster,
+		TaskDefinition:           taskDefinition,
+		LaunchType:               launchType,
+		CapacityProviderStrategy: capacityProviders,
+		PlatformVersion:          platformVersion,
+		Subnets:                  strings.Split(parameters[ParameterSubnetIds], ","),
+		SecurityGroups:           uniqueStrings(securityGroups),
+		AssignPublicIP:           assignPublicIP,
+		Container:                service.Name,
+	}, nil
+}
+
+// getClusterName returns the cluster the stack created, or the one it has been deployed to
+func getClusterName(parameters map[string]string, resources map[string]string) string {
+	if c, ok := resources["Cluster"]; ok {
+		return c
+	}
+	return parameters[ParameterClusterName]
+}
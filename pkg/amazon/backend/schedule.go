@@ -0,0 +1,99 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+
+	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation"
+	"github.com/awslabs/goformation/v4/cloudformation/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation/events"
+	"github.com/awslabs/goformation/v4/cloudformation/iam"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+)
+
+const EventsRole = "EventsRole"
+
+// getSchedule returns the schedule expression set by x-aws-schedule, or an empty string for a long-running service
+func getSchedule(service types.ServiceConfig) (string, error) {
+	ext, ok := service.Extensions[compose.ExtensionSchedule]
+	if !ok {
+		return "", nil
+	}
+	schedule, _ := ext.(string)
+	if !(strings.HasPrefix(schedule, "cron(") || strings.HasPrefix(schedule, "rate(")) || !strings.HasSuffix(schedule, ")") {
+		return "", fmt.Errorf("service %s: %s must be a cron(...) or rate(...) expression, got %q", service.Name, compose.ExtensionSchedule, ext)
+	}
+	if len(service.Ports) > 0 {
+		return "", fmt.Errorf("service %s: scheduled tasks can't publish ports", service.Name)
+	}
+	return schedule, nil
+}
+
+func isScheduled(service types.ServiceConfig) bool {
+	_, ok := service.Extensions[compose.ExtensionSchedule]
+	return ok
+}
+
+// createScheduledTask creates an EventBridge rule to run the service task definition on schedule, within the same
+// subnets and security groups as a service would
+func createScheduledTask(project *types.Project, service types.ServiceConfig, template *cloudformation.Template, schedule string, taskDefinition string, securityGroups []string, ec2 bool) error {
+	assignPublicIP, err := getAssignPublicIP(project, service)
+	if err != nil {
+		return err
+	}
+
+	count := 1
+	if service.Deploy != nil && service.Deploy.Replicas != nil {
+		count = int(*service.Deploy.Replicas)
+	}
+
+	launchType := ecsapi.LaunchTypeFargate
+	platformVersion := ""
+	if ec2 {
+		launchType = ecsapi.LaunchTypeEc2
+	} else if usesEFSVolumes(template.Resources[taskDefinition].(*ecs.TaskDefinition)) {
+		platformVersion = FargatePlatformVersion
+	}
+
+	if _, ok := template.Resources[EventsRole]; !ok {
+		template.Resources[EventsRole] = &iam.Role{
+			AssumeRolePolicyDocument: assumeRolePolicy("events.amazonaws.com"),
+			ManagedPolicyArns: []string{
+				ECSEventsPolicy,
+			},
+		}
+	}
+
+	clusterARN := cloudformation.If("CreateCluster",
+		cloudformation.GetAtt("Cluster", "Arn"),
+		cloudformation.Sub(fmt.Sprintf("arn:${AWS::Partition}:ecs:${AWS::Region}:${AWS::AccountId}:cluster/${%s}", ParameterClusterName)))
+
+	template.Resources[fmt.Sprintf("%sSchedule", serviceLogicalName(project, service.Name))] = &events.Rule{
+		Description:        fmt.Sprintf("Run %q task on schedule", service.Name),
+		ScheduleExpression: schedule,
+		State:              "ENABLED",
+		Targets: []events.Rule_Target{
+			{
+				Arn: clusterARN,
+				EcsParameters: &events.Rule_EcsParameters{
+					LaunchType: launchType,
+					NetworkConfiguration: &events.Rule_NetworkConfiguration{
+						AwsVpcConfiguration: &events.Rule_AwsVpcConfiguration{
+							AssignPublicIp: assignPublicIP,
+							SecurityGroups: securityGroups,
+							Subnets:        []string{cloudformation.Ref(ParameterSubnetIds)},
+						},
+					},
+					PlatformVersion:   platformVersion,
+					TaskCount:         count,
+					TaskDefinitionArn: cloudformation.Ref(taskDefinition),
+				},
+				Id:      serviceLogicalName(project, service.Name),
+				RoleArn: cloudformation.GetAtt(EventsRole, "Arn"),
+			},
+		},
+	}
+	return nil
+}
@@ -0,0 +1,421 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/gorilla/websocket"
+	"github.com/moby/term"
+)
+
+// SSM data channel message types
+const (
+	messageInputStreamData  = "input_stream_data"
+	messageOutputStreamData = "output_stream_data"
+	messageAcknowledge      = "acknowledge"
+	messageChannelClosed    = "channel_closed"
+)
+
+// SSM data channel payload types
+const (
+	payloadOutput            = 1
+	payloadSize              = 3
+	payloadHandshakeRequest  = 5
+	payloadHandshakeResponse = 6
+	payloadHandshakeComplete = 7
+)
+
+const (
+	// sessionClientVersion is the Session Manager plugin version the data channel protocol is implemented after
+	sessionClientVersion = "1.2.0.0"
+	// sessionHeaderLength is the length of the header of data channel messages, up to the payload length
+	sessionHeaderLength = 116
+	// sessionPingInterval keeps the data channel open while the session is idle
+	sessionPingInterval = 5 * time.Minute
+	// sessionResizeInterval is how often the terminal size is checked, so the remote terminal follows it
+	sessionResizeInterval = 500 * time.Millisecond
+)
+
+// sessionMessage is a binary message of the SSM data channel, which header fields are big endian
+type sessionMessage struct {
+	MessageType    string
+	SchemaVersion  uint32
+	CreatedDate    uint64
+	SequenceNumber int64
+	Flags          uint64
+	MessageID      [16]byte
+	PayloadType    uint32
+	Payload        []byte
+}
+
+func (m sessionMessage) marshal() []byte {
+	buf := make([]byte, sessionHeaderLength+4+len(m.Payload))
+	binary.BigEndian.PutUint32(buf[0:], sessionHeaderLength)
+	copy(buf[4:36], fmt.Sprintf("%-32s", m.MessageType))
+	binary.BigEndian.PutUint32(buf[36:], m.SchemaVersion)
+	binary.BigEndian.PutUint64(buf[40:], m.CreatedDate)
+	binary.BigEndian.PutUint64(buf[48:], uint64(m.SequenceNumber))
+	binary.BigEndian.PutUint64(buf[56:], m.Flags)
+	// the least significant half of the message ID comes first
+	copy(buf[64:72], m.MessageID[8:])
+	copy(buf[72:80], m.MessageID[:8])
+	digest := sha256.Sum256(m.Payload)
+	copy(buf[80:112], digest[:])
+	binary.BigEndian.PutUint32(buf[112:], m.PayloadType)
+	binary.BigEndian.PutUint32(buf[116:], uint32(len(m.Payload)))
+	copy(buf[120:], m.Payload)
+	return buf
+}
+
+func unmarshalSessionMessage(buf []byte) (sessionMessage, error) {
+	if len(buf) < sessionHeaderLength+4 {
+		return sessionMessage{}, fmt.Errorf("invalid session message of %d bytes", len(buf))
+	}
+	header := int(binary.BigEndian.Uint32(buf[0:]))
+	if header < sessionHeaderLength || len(buf) < header+4 {
+		return sessionMessage{}, fmt.Errorf("invalid session message header length %d", header)
+	}
+	m := sessionMessage{
+		MessageType:    strings.TrimRight(string(bytes.TrimRight(buf[4:36], "\x00")), " "),
+		SchemaVersion:  binary.BigEndian.Uint32(buf[36:]),
+		CreatedDate:    binary.BigEndian.Uint64(buf[40:]),
+		SequenceNumber: int64(binary.BigEndian.Uint64(buf[48:])),
+		Flags:          binary.BigEndian.Uint64(buf[56:]),
+		PayloadType:    binary.BigEndian.Uint32(buf[112:]),
+	}
+	copy(m.MessageID[:8], buf[72:80])
+	copy(m.MessageID[8:], buf[64:72])
+	length := int(binary.BigEndian.Uint32(buf[header:]))
+	if len(buf) < header+4+length {
+		return sessionMessage{}, fmt.Errorf("invalid session message payload length %d", length)
+	}
+	m.Payload = buf[header+4 : header+4+length]
+	return m, nil
+}
+
+// newMessageID returns a random UUID
+func newMessageID() [16]byte {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	// version 4, RFC 4122 variant
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return id
+}
+
+func formatMessageID(id [16]byte) string {
+	s := hex.EncodeToString(id[:])
+	return fmt.Sprintf("%s-%s-%s-%s-%s", s[0:8], s[8:12], s[12:16], s[16:20], s[20:32])
+}
+
+type handshakeRequest struct {
+	AgentVersion           string
+	RequestedClientActions []struct {
+		ActionType string
+	}
+}
+
+type handshakeResponse struct {
+	ClientVersion          string
+	ProcessedClientActions []processedClientAction
+	Errors                 []string
+}
+
+type processedClientAction struct {
+	ActionType   string
+	ActionStatus int
+	Error        string `json:",omitempty"`
+}
+
+type acknowledgeContent struct {
+	AcknowledgedMessageType           string
+	AcknowledgedMessageID             string `json:"AcknowledgedMessageId"`
+	AcknowledgedMessageSequenceNumber int64
+	IsSequentialMessage               bool
+}
+
+type terminalSize struct {
+	Cols uint16 `json:"cols"`
+	Rows uint16 `json:"rows"`
+}
+
+// execSession is the SSM session ECS Exec opens into a container. It streams the standard input to the command run
+// in the container and its output back, through the SSM data channel protocol also implemented by the Session
+// Manager plugin.
+type execSession struct {
+	conn *websocket.Conn
+	// lock serializes writes to the websocket, which only supports a single writer
+	lock     sync.Mutex
+	sequence int64
+}
+
+// openExecSession connects to the data channel of an SSM session
+func openExecSession(ctx context.Context, session compose.ExecSession) (*execSession, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, session.StreamURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session %s: %s", session.SessionID, err)
+	}
+	s := &execSession{conn: conn}
+	open, err := json.Marshal(map[string]string{
+		"MessageSchemaVersion": "1.0",
+		"RequestId":            formatMessageID(newMessageID()),
+		"TokenValue":           session.TokenValue,
+		"ClientId":             formatMessageID(newMessageID()),
+		"ClientVersion":        sessionClientVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.write(websocket.TextMessage, open); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *execSession) write(messageType int, data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.conn.WriteMessage(messageType, data)
+}
+
+func (s *execSession) send(m sessionMessage) error {
+	m.SchemaVersion = 1
+	m.CreatedDate = uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	m.MessageID = newMessageID()
+	return s.write(websocket.BinaryMessage, m.marshal())
+}
+
+// sendInput sends data to the remote command, in the sequence the agent acknowledges
+func (s *execSession) sendInput(payloadType uint32, payload []byte) error {
+	s.lock.Lock()
+	sequence := s.sequence
+	s.sequence++
+	s.lock.Unlock()
+	var flags uint64
+	if sequence == 0 {
+		// the first message of the stream
+		flags = 1
+	}
+	return s.send(sessionMessage{
+		MessageType:    messageInputStreamData,
+		SequenceNumber: sequence,
+		Flags:          flags,
+		PayloadType:    payloadType,
+		Payload:        payload,
+	})
+}
+
+func (s *execSession) acknowledge(m sessionMessage) error {
+	content, err := json.Marshal(acknowledgeContent{
+		AcknowledgedMessageType:           m.MessageType,
+		AcknowledgedMessageID:             formatMessageID(m.MessageID),
+		AcknowledgedMessageSequenceNumber: m.SequenceNumber,
+		IsSequentialMessage:               true,
+	})
+	if err != nil {
+		return err
+	}
+	return s.send(sessionMessage{
+		MessageType: messageAcknowledge,
+		Flags:       3,
+		Payload:     content,
+	})
+}
+
+// run streams in to the remote command and its output to out, until the session is closed. A terminal input is set
+// in raw mode, so control characters are sent to the remote terminal which size follows the local one.
+func (s *execSession) run(ctx context.Context, in io.Reader, out io.Writer) error {
+	defer s.conn.Close()
+	if fd, isTerminal := term.GetFdInfo(in); isTerminal {
+		state, err := term.SetRawTerminal(fd)
+		if err != nil {
+			return err
+		}
+		defer term.RestoreTerminal(fd, state) // nolint:errcheck
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	ready := make(chan struct{})
+	go s.keepAlive(done)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.receive(out, ready)
+	}()
+
+	select {
+	case <-ready:
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	go s.followTerminalSize(in, done)
+	go s.forwardInput(in, errs)
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// receive processes the messages of the agent, writing the command output to out, and closes ready once the
+// handshake completes. Returns when the channel is closed.
+func (s *execSession) receive(out io.Writer, ready chan<- struct{}) error {
+	expected := int64(0)
+	pending := map[int64]sessionMessage{}
+	for {
+		messageType, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return nil
+			}
+			return err
+		}
+		if messageType != websocket.BinaryMessage {
+			continue
+		}
+		m, err := unmarshalSessionMessage(data)
+		if err != nil {
+			return err
+		}
+		switch m.MessageType {
+		case messageChannelClosed:
+			return nil
+		case messageOutputStreamData:
+			if err := s.acknowledge(m); err != nil {
+				return err
+			}
+			if m.SequenceNumber < expected {
+				// already processed, the agent didn't get the acknowledgement in time
+				continue
+			}
+			pending[m.SequenceNumber] = m
+			for {
+				next, ok := pending[expected]
+				if !ok {
+					break
+				}
+				delete(pending, expected)
+				expected++
+				if err := s.process(next, out, ready); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (s *execSession) process(m sessionMessage, out io.Writer, ready chan<- struct{}) error {
+	switch m.PayloadType {
+	case payloadOutput:
+		_, err := out.Write(m.Payload)
+		return err
+	case payloadHandshakeRequest:
+		return s.handshake(m.Payload)
+	case payloadHandshakeComplete:
+		close(ready)
+	}
+	return nil
+}
+
+// handshake accepts the standard stream sessions ECS Exec opens, encrypted sessions aren't supported
+func (s *execSession) handshake(payload []byte) error {
+	request := handshakeRequest{}
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return err
+	}
+	response := handshakeResponse{
+		ClientVersion:          sessionClientVersion,
+		ProcessedClientActions: []processedClientAction{},
+		Errors:                 []string{},
+	}
+	for _, action := range request.RequestedClientActions {
+		if action.ActionType != "SessionType" {
+			return fmt.Errorf("session requires %s, which is not supported", action.ActionType)
+		}
+		response.ProcessedClientActions = append(response.ProcessedClientActions, processedClientAction{
+			ActionType:   action.ActionType,
+			ActionStatus: 1,
+		})
+	}
+	content, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return s.sendInput(payloadHandshakeResponse, content)
+}
+
+func (s *execSession) forwardInput(in io.Reader, errs chan<- error) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			if err := s.sendInput(payloadOutput, append([]byte{}, buf[:n]...)); err != nil {
+				errs <- err
+				return
+			}
+		}
+		if err != nil {
+			// the remote command keeps running until it exits, which closes the session
+			return
+		}
+	}
+}
+
+func (s *execSession) followTerminalSize(in io.Reader, done <-chan struct{}) {
+	fd, isTerminal := term.GetFdInfo(in)
+	if !isTerminal {
+		return
+	}
+	ticker := time.NewTicker(sessionResizeInterval)
+	defer ticker.Stop()
+	size := terminalSize{}
+	for {
+		if winsize, err := term.GetWinsize(fd); err == nil {
+			current := terminalSize{Cols: winsize.Width, Rows: winsize.Height}
+			if current != size {
+				size = current
+				content, _ := json.Marshal(size)
+				if err := s.sendInput(payloadSize, content); err != nil {
+					return
+				}
+			}
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *execSession) keepAlive(done <-chan struct{}) {
+	ticker := time.NewTicker(sessionPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := s.write(websocket.PingMessage, []byte("keepalive")); err != nil {
+				return
+			}
+		}
+	}
+}
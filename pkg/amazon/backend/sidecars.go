@@ -0,0 +1,59 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+)
+
+// sidecarOf returns the service a sidecar container runs along, as set by network_mode `service:<name>` or
+// x-aws-sidecar-of, or an empty string for a regular service
+func sidecarOf(service types.ServiceConfig) string {
+	if strings.HasPrefix(service.NetworkMode, "service:") {
+		return strings.TrimPrefix(service.NetworkMode, "service:")
+	}
+	if v, ok := service.Extensions[compose.ExtensionSidecarOf]; ok {
+		return v.(string)
+	}
+	return ""
+}
+
+// getSidecars indexes sidecar containers by the service they run along
+func getSidecars(project *types.Project) (map[string][]types.ServiceConfig, error) {
+	sidecars := map[string][]types.ServiceConfig{}
+	for _, service := range project.Services {
+		parent := sidecarOf(service)
+		if parent == "" {
+			continue
+		}
+		p, err := project.GetService(parent)
+		if err != nil {
+			return nil, fmt.Errorf("sidecar %s: %s", service.Name, err)
+		}
+		if sidecarOf(p) != "" {
+			return nil, fmt.Errorf("sidecar %s can't run along %s, which is a sidecar itself", service.Name, parent)
+		}
+		sidecars[parent] = append(sidecars[parent], service)
+	}
+	for _, containers := range sidecars {
+		sort.Slice(containers, func(i, j int) bool {
+			return containers[i].Name < containers[j].Name
+		})
+	}
+	return sidecars, nil
+}
+
+// getServiceDependency returns the service which runs the container for a depends_on entry
+func getServiceDependency(project *types.Project, dependency string) string {
+	service, err := project.GetService(dependency)
+	if err != nil {
+		return dependency
+	}
+	if parent := sidecarOf(service); parent != "" {
+		return parent
+	}
+	return dependency
+}
@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"fmt"
+
+	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+	"github.com/mitchellh/mapstructure"
+)
+
+// subnets is the content of the x-aws-subnets extension
+type subnets struct {
+	Public  []string `mapstructure:"public"`
+	Private []string `mapstructure:"private"`
+}
+
+func getSubnets(project *types.Project) (*subnets, error) {
+	ext, ok := project.Extensions[compose.ExtensionSubnets]
+	if !ok {
+		return nil, nil
+	}
+	s := &subnets{}
+	if err := mapstructure.Decode(ext, s); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", compose.ExtensionSubnets, err)
+	}
+	return s, nil
+}
+
+// taskSubnets returns the subnets tasks run in: private subnets when set, so tasks reach the internet through NAT
+func (s *subnets) taskSubnets() []string {
+	if len(s.Private) > 0 {
+		return s.Private
+	}
+	return s.Public
+}
+
+// createsLoadBalancer tells if the project gets a load balancer created, as it publishes ports without setting an
+// existing load balancer by x-aws-loadbalancer
+func createsLoadBalancer(project *types.Project) bool {
+	if _, ok := project.Extensions[compose.ExtensionLB]; ok {
+		return false
+	}
+	for _, service := range project.Services {
+		if len(service.Ports) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// getLoadBalancerScheme returns the load balancer scheme set by x-aws-loadbalancer_scheme, internet-facing by default
+func getLoadBalancerScheme(project *types.Project) (string, error) {
+	ext, ok := project.Extensions[compose.ExtensionLoadBalancerScheme]
+	if !ok {
+		return elbv2.LoadBalancerSchemeEnumInternetFacing, nil
+	}
+	switch scheme := ext.(string); scheme {
+	case elbv2.LoadBalancerSchemeEnumInternetFacing, elbv2.LoadBalancerSchemeEnumInternal:
+		return scheme, nil
+	default:
+		return "", fmt.Errorf("%s must be one of %s or %s, got %q", compose.ExtensionLoadBalancerScheme, elbv2.LoadBalancerSchemeEnumInternetFacing, elbv2.LoadBalancerSchemeEnumInternal, scheme)
+	}
+}
+
+// getAssignPublicIP tells if tasks get a public IP. This can be set by x-aws-assign_public_ip on service or project,
+// and is disabled by default when tasks run in private subnets
+func getAssignPublicIP(project *types.Project, service types.ServiceConfig) (string, error) {
+	ext, ok := service.Extensions[compose.ExtensionAssignPublicIP]
+	if !ok {
+		ext, ok = project.Extensions[compose.ExtensionAssignPublicIP]
+	}
+	if ok {
+		assign, isBool := ext.(bool)
+		if !isBool {
+			return "", fmt.Errorf("%s must be a boolean", compose.ExtensionAssignPublicIP)
+		}
+		if assign {
+			return ecsapi.AssignPublicIpEnabled, nil
+		}
+		return ecsapi.AssignPublicIpDisabled, nil
+	}
+
+	s, err := getSubnets(project)
+	if err != nil {
+		return "", err
+	}
+	if s != nil && len(s.Private) > 0 {
+		return ecsapi.AssignPublicIpDisabled, nil
+	}
+	return ecsapi.AssignPublicIpEnabled, nil
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
+	"github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/compose-spec/compose-go/cli"
 	"github.com/compose-spec/compose-go/types"
 	"github.com/docker/ecs-plugin/pkg/compose"
@@ -28,22 +30,30 @@ func (b *Backend) Up(ctx context.Context, options *cli.ProjectOptions) error {
 		return err
 	}
 
-	template, err := b.Convert(project)
+	vpc, err := b.GetVPC(ctx, project)
 	if err != nil {
 		return err
 	}
 
-	vpc, err := b.GetVPC(ctx, project)
+	subNets, loadBalancerSubNets, err := b.GetSubNets(ctx, project, vpc)
 	if err != nil {
 		return err
 	}
 
-	subNets, err := b.api.GetSubNets(ctx, vpc)
+	// check the project before building images, which may take a while
+	err = check(project)
 	if err != nil {
 		return err
 	}
-	if len(subNets) < 2 {
-		return fmt.Errorf("VPC %s should have at least 2 associated subnets in different availability zones", vpc)
+
+	images, err := b.buildImages(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	template, err := b.createTemplate(project)
+	if err != nil {
+		return err
 	}
 
 	lb, err := b.GetLoadBalancer(ctx, project)
@@ -54,15 +64,43 @@ func (b *Backend) Up(ctx context.Context, options *cli.ProjectOptions) error {
 	parameters := map[string]string{
 		ParameterClusterName:     cluster,
 		ParameterVPCId:           vpc,
-		ParameterSubnet1Id:       subNets[0],
-		ParameterSubnet2Id:       subNets[1],
+		ParameterSubnetIds:       strings.Join(subNets, ","),
 		ParameterLoadBalancerARN: lb,
+
+		ParameterLoadBalancerSubnetIds: strings.Join(loadBalancerSubNets, ","),
+	}
+	for parameter, image := range images {
+		parameters[parameter] = image
 	}
 
 	update, err := b.api.StackExists(ctx, project.Name)
 	if err != nil {
 		return err
 	}
+
+	previous, err := b.getStackResources(ctx, project.Name, update)
+	if err != nil {
+		return err
+	}
+	err = keepScaledDesiredCounts(project, template, previous)
+	if err != nil {
+		return err
+	}
+	deployed, err := b.getDeployedTaskDefinitions(ctx, project, template, previous)
+	if err != nil {
+		return err
+	}
+	for parameter, taskDefinition := range deployed {
+		parameters[parameter] = taskDefinition
+	}
+	retained, err := b.getRetainedFileSystems(ctx, project, previous)
+	if err != nil {
+		return err
+	}
+	for parameter, fileSystem := range retained {
+		parameters[parameter] = fileSystem
+	}
+
 	operation := compose.StackCreate
 	if update {
 		operation = compose.StackUpdate
@@ -90,7 +128,10 @@ func (b *Backend) Up(ctx context.Context, options *cli.ProjectOptions) error {
 	}()
 
 	err = b.WaitStackCompletion(ctx, project.Name, operation)
-	return err
+	if err != nil {
+		return err
+	}
+	return b.deployBlueGreenServices(ctx, project, template, previous)
 }
 
 func (b Backend) GetVPC(ctx context.Context, project *types.Project) (string, error) {
@@ -113,6 +154,76 @@ func (b Backend) GetVPC(ctx context.Context, project *types.Project) (string, er
 	return defaultVPC, nil
 }
 
+// GetSubNets returns the subnets to run tasks in, and the ones to deploy the load balancer to. Subnets are selected
+// by x-aws-subnets, or default to the first ones in VPC
+func (b Backend) GetSubNets(ctx context.Context, project *types.Project, vpc string) ([]string, []string, error) {
+	config, err := getSubnets(project)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config == nil {
+		subNets, err := b.api.GetSubNets(ctx, vpc)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(subNets) < MinSubnets {
+			return nil, nil, fmt.Errorf("VPC %s should have at least %d associated subnets in different availability zones", vpc, MinSubnets)
+		}
+		return subNets, subNets, nil
+	}
+
+	subNets := config.taskSubnets()
+	if len(subNets) < MinSubnets {
+		return nil, nil, fmt.Errorf("%s should declare at least %d subnets in different availability zones", compose.ExtensionSubnets, MinSubnets)
+	}
+
+	scheme, err := getLoadBalancerScheme(project)
+	if err != nil {
+		return nil, nil, err
+	}
+	loadBalancerSubNets := subNets
+	if scheme == elbv2.LoadBalancerSchemeEnumInternetFacing {
+		switch {
+		case len(config.Public) > 0:
+			loadBalancerSubNets = config.Public
+		case len(config.Private) > 0 && createsLoadBalancer(project):
+			// an internet-facing load balancer in private subnets would not be reachable
+			return nil, nil, fmt.Errorf("internet-facing load balancer requires public subnets, set them in %s or set %s to %s", compose.ExtensionSubnets, compose.ExtensionLoadBalancerScheme, elbv2.LoadBalancerSchemeEnumInternal)
+		}
+	}
+	if len(loadBalancerSubNets) < MinSubnets {
+		return nil, nil, fmt.Errorf("%s should declare at least %d public subnets in different availability zones", compose.ExtensionSubnets, MinSubnets)
+	}
+	if err := b.checkDistinctZones(ctx, subNets); err != nil {
+		return nil, nil, err
+	}
+	if err := b.checkDistinctZones(ctx, loadBalancerSubNets); err != nil {
+		return nil, nil, err
+	}
+	return subNets, loadBalancerSubNets, nil
+}
+
+// checkDistinctZones returns an error if subnets declared by x-aws-subnets share an availability zone, as EFS file
+// systems get a single mount target per zone and load balancers accept a single subnet per zone
+func (b Backend) checkDistinctZones(ctx context.Context, subNets []string) error {
+	zones, err := b.api.GetSubnetZones(ctx, subNets)
+	if err != nil {
+		return err
+	}
+	subnetByZone := map[string]string{}
+	for _, subnet := range subNets {
+		zone, ok := zones[subnet]
+		if !ok {
+			return fmt.Errorf("%s declares subnet %s which does not exist", compose.ExtensionSubnets, subnet)
+		}
+		if other, ok := subnetByZone[zone]; ok {
+			return fmt.Errorf("%s declares subnets %s and %s in the same availability zone %s", compose.ExtensionSubnets, other, subnet, zone)
+		}
+		subnetByZone[zone] = subnet
+	}
+	return nil
+}
+
 func (b Backend) GetLoadBalancer(ctx context.Context, project *types.Project) (string, error) {
 	//check compose file for custom VPC selected
 	if ext, ok := project.Extensions[compose.ExtensionLB]; ok {
@@ -0,0 +1,284 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ecsapi "github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation"
+	"github.com/awslabs/goformation/v4/cloudformation/ecs"
+	"github.com/awslabs/goformation/v4/cloudformation/efs"
+	"github.com/awslabs/goformation/v4/cloudformation/policies"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/ecs-plugin/pkg/compose"
+)
+
+// FargatePlatformVersion is the first Fargate platform version to support EFS volumes and ECS Exec
+const FargatePlatformVersion = "1.4.0"
+
+// createVolumes creates an EFS file system and access point for each named volume, and mount targets so tasks can
+// reach the file system from each subnet. The template doesn't depend on the number of subnets up deploys to: mount
+// targets are created for up to MaxZones subnets, each of them only if the subnets parameter lists that many. File systems are retained when the stack is deleted, so volume data
+// persists: up reuses the file system tagged for a volume, passing it as a parameter, rather than creating a new one.
+// Volumes set with x-aws-efs reuse an existing file system, which is then expected to already have mount targets
+// within the VPC.
+// Returns the mount targets created for each volume, so services can wait for them to be available.
+func createVolumes(project *types.Project, template *cloudformation.Template, securityGroups []string) map[string][]string {
+	mountTargets := map[string][]string{}
+	if createsFileSystems(project) {
+		createSubnetConditions(template)
+	}
+	for name, volume := range project.Volumes {
+		if _, ok := volume.Extensions[compose.ExtensionEFS]; !ok {
+			parameter := fileSystemParameterName(project, name)
+			template.Parameters[parameter] = cloudformation.Parameter{
+				Type:        "String",
+				Description: fmt.Sprintf("ID of the EFS file system retained for volume %s (optional)", name),
+				Default:     "",
+			}
+			condition := fmt.Sprintf("Create%sFilesystem", volumeLogicalName(project, name))
+			template.Conditions[condition] = cloudformation.Equals("", cloudformation.Ref(parameter))
+
+			fileSystem := fileSystemResourceName(project, name)
+			template.Resources[fileSystem] = &efs.FileSystem{
+				AWSCloudFormationCondition:      condition,
+				AWSCloudFormationDeletionPolicy: policies.DeletionPolicy("Retain"),
+				Encrypted:                       true,
+				FileSystemTags: []efs.FileSystem_ElasticFileSystemTag{
+					{
+						Key:   compose.ProjectTag,
+						Value: project.Name,
+					},
+					{
+						Key:   compose.VolumeTag,
+						Value: name,
+					},
+				},
+			}
+
+			for i := 0; i < MaxZones; i++ {
+				mountTarget := fmt.Sprintf("%sNFSMountTargetOnSubnet%d", volumeLogicalName(project, name), i+1)
+				template.Resources[mountTarget] = &efs.MountTarget{
+					AWSCloudFormationCondition: subnetConditionName(i),
+					FileSystemId:               fileSystemID(project, name),
+					SecurityGroups:             securityGroups,
+					SubnetId:                   cloudformation.Select(strconv.Itoa(i), []string{cloudformation.Ref(ParameterSubnetIds)}),
+				}
+				mountTargets[name] = append(mountTargets[name], mountTarget)
+			}
+		}
+
+		template.Resources[accessPointResourceName(project, name)] = &efs.AccessPoint{
+			AccessPointTags: []efs.AccessPoint_AccessPointTag{
+				{
+					Key:   compose.ProjectTag,
+					Value: project.Name,
+				},
+				{
+					Key:   compose.VolumeTag,
+					Value: name,
+				},
+			},
+			FileSystemId:  fileSystemID(project, name),
+			PosixUser:     toPosixUser(volume.DriverOpts),
+			RootDirectory: toRootDirectory(volume.DriverOpts),
+		}
+	}
+	return mountTargets
+}
+
+// createSubnetConditions adds a condition for each of the MaxZones first subnets, true if the subnets parameter lists
+// it. The list is padded with empty items, so selecting an item after the last subnet gives an empty string rather
+// than failing.
+func createSubnetConditions(template *cloudformation.Template) {
+	subnets := cloudformation.Split(",", cloudformation.Join("", []string{
+		cloudformation.Join(",", cloudformation.Ref(ParameterSubnetIds)),
+		strings.Repeat(",", MaxZones),
+	}))
+	for i := 0; i < MaxZones; i++ {
+		template.Conditions[subnetConditionName(i)] = cloudformation.Not([]string{
+			cloudformation.Equals("", cloudformation.Select(strconv.Itoa(i), []string{subnets})),
+		})
+	}
+}
+
+func subnetConditionName(index int) string {
+	return fmt.Sprintf("HasSubnet%d", index+1)
+}
+
+// getPlatformVersion returns the Fargate platform version a task requires, none when it runs on EC2 instances or
+// doesn't use any feature the latest platform version may lack
+func getPlatformVersion(project *types.Project, containers []types.ServiceConfig) (string, error) {
+	if usesEC2(project) {
+		return "", nil
+	}
+	exec, err := usesExec(containers)
+	if err != nil {
+		return "", err
+	}
+	if exec || mountsVolumes(containers) {
+		return FargatePlatformVersion, nil
+	}
+	return "", nil
+}
+
+// mountsVolumes tells if containers mount named volumes, backed by EFS file systems
+func mountsVolumes(containers []types.ServiceConfig) bool {
+	for _, container := range containers {
+		for _, v := range container.Volumes {
+			if v.Type == types.VolumeTypeVolume {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// createsFileSystems tells if the project has named volumes which get an EFS file system created
+func createsFileSystems(project *types.Project) bool {
+	for _, volume := range project.Volumes {
+		if _, ok := volume.Extensions[compose.ExtensionEFS]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+func toPosixUser(opts map[string]string) *efs.AccessPoint_PosixUser {
+	uid, gid := opts["uid"], opts["gid"]
+	if uid == "" || gid == "" {
+		return nil
+	}
+	return &efs.AccessPoint_PosixUser{
+		Uid: uid,
+		Gid: gid,
+	}
+}
+
+func toRootDirectory(opts map[string]string) *efs.AccessPoint_RootDirectory {
+	path := opts["root_directory"]
+	if path == "" {
+		return nil
+	}
+	root := &efs.AccessPoint_RootDirectory{
+		Path: path,
+	}
+	uid, gid := opts["uid"], opts["gid"]
+	if uid != "" && gid != "" {
+		permissions := opts["permissions"]
+		if permissions == "" {
+			permissions = "0755"
+		}
+		// let EFS create the root directory on first use, owned by the access point user
+		root.CreationInfo = &efs.AccessPoint_CreationInfo{
+			OwnerUid:    uid,
+			OwnerGid:    gid,
+			Permissions: permissions,
+		}
+	}
+	return root
+}
+
+func toVolumes(project *types.Project, service types.ServiceConfig) ([]ecs.TaskDefinition_Volume, []ecs.TaskDefinition_MountPoint) {
+	var (
+		volumes []ecs.TaskDefinition_Volume
+		mounts  []ecs.TaskDefinition_MountPoint
+	)
+	known := map[string]bool{}
+	for _, v := range service.Volumes {
+		if v.Type != types.VolumeTypeVolume {
+			continue
+		}
+		name := volumeLogicalName(project, v.Source)
+		if !known[name] {
+			known[name] = true
+			volumes = append(volumes, ecs.TaskDefinition_Volume{
+				Name: name,
+				EFSVolumeConfiguration: &ecs.TaskDefinition_EFSVolumeConfiguration{
+					AuthorizationConfig: &ecs.TaskDefinition_AuthorizationConfig{
+						AccessPointId: cloudformation.Ref(accessPointResourceName(project, v.Source)),
+					},
+					FilesystemId:      fileSystemID(project, v.Source),
+					TransitEncryption: ecsapi.EFSTransitEncryptionEnabled,
+				},
+			})
+		}
+		mounts = append(mounts, ecs.TaskDefinition_MountPoint{
+			ContainerPath: v.Target,
+			ReadOnly:      v.ReadOnly,
+			SourceVolume:  name,
+		})
+	}
+	return volumes, mounts
+}
+
+func usesEFSVolumes(definition *ecs.TaskDefinition) bool {
+	for _, v := range definition.Volumes {
+		if v.EFSVolumeConfiguration != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func fileSystemID(project *types.Project, name string) string {
+	if id, ok := project.Volumes[name].Extensions[compose.ExtensionEFS].(string); ok {
+		return id
+	}
+	return cloudformation.If(fmt.Sprintf("Create%sFilesystem", volumeLogicalName(project, name)),
+		cloudformation.Ref(fileSystemResourceName(project, name)),
+		cloudformation.Ref(fileSystemParameterName(project, name)))
+}
+
+// checkVolumes checks x-aws-efs sets the ID of the file system backing a volume
+func checkVolumes(project *types.Project) error {
+	for name, volume := range project.Volumes {
+		id, ok := volume.Extensions[compose.ExtensionEFS]
+		if !ok {
+			continue
+		}
+		if _, ok := id.(string); !ok {
+			return fmt.Errorf("volume %s: %s must be the ID of an EFS file system, got %v", name, compose.ExtensionEFS, id)
+		}
+	}
+	return nil
+}
+
+func fileSystemParameterName(project *types.Project, volume string) string {
+	return fmt.Sprintf("Parameter%sFilesystem", volumeLogicalName(project, volume))
+}
+
+// getRetainedFileSystems returns the parameters passing the file systems retained by a previous deployment of the
+// project to the volumes which file system isn't managed by the stack
+func (b *Backend) getRetainedFileSystems(ctx context.Context, project *types.Project, resources map[string]string) (map[string]string, error) {
+	retained := map[string]string{}
+	for name, volume := range project.Volumes {
+		if _, ok := volume.Extensions[compose.ExtensionEFS]; ok {
+			continue
+		}
+		if _, ok := resources[fileSystemResourceName(project, name)]; ok {
+			continue
+		}
+		id, err := b.api.FindFileSystem(ctx, map[string]string{
+			compose.ProjectTag: project.Name,
+			compose.VolumeTag:  name,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if id != "" {
+			retained[fileSystemParameterName(project, name)] = id
+		}
+	}
+	return retained, nil
+}
+
+func fileSystemResourceName(project *types.Project, volume string) string {
+	return fmt.Sprintf("%sFilesystem", volumeLogicalName(project, volume))
+}
+
+func accessPointResourceName(project *types.Project, volume string) string {
+	return fmt.Sprintf("%sAccessPoint", volumeLogicalName(project, volume))
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/docker/ecs-plugin/pkg/compose"
 	"github.com/docker/ecs-plugin/pkg/progress"
 )
@@ -75,9 +76,15 @@ func (b *Backend) WaitStackCompletion(ctx context.Context, name string, operatio
 			default:
 				if strings.HasSuffix(status, "_FAILED") {
 					progressStatus = progress.Error
+					if isCircuitBreakerFailure(event) {
+						status = fmt.Sprintf("%s (deployment circuit breaker triggered)", status)
+					}
 					if stackErr == nil {
 						operation = compose.StackDelete
 						stackErr = fmt.Errorf(reason)
+						if isCircuitBreakerFailure(event) {
+							stackErr = fmt.Errorf("%s deployment has been stopped by the deployment circuit breaker, as tasks failed to start: %s", resource, reason)
+						}
 					}
 				}
 			}
@@ -91,3 +98,9 @@ func (b *Backend) WaitStackCompletion(ctx context.Context, name string, operatio
 
 	return stackErr
 }
+
+// isCircuitBreakerFailure tells if a service deployment failed because of the ECS deployment circuit breaker
+func isCircuitBreakerFailure(event *cloudformation.StackEvent) bool {
+	return aws.StringValue(event.ResourceType) == "AWS::ECS::Service" &&
+		strings.Contains(strings.ToLower(aws.StringValue(event.ResourceStatusReason)), "circuit breaker")
+}
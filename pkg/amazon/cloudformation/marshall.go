@@ -3,11 +3,14 @@ package cloudformation
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/awslabs/goformation/v4/cloudformation"
 )
 
+// Marshall serializes a template into JSON, with object keys and the DependsOn lists of resources sorted, so that a
+// template always gives byte-identical output
 func Marshall(template *cloudformation.Template) ([]byte, error) {
 	raw, err := template.JSON()
 	if err != nil {
@@ -20,14 +23,26 @@ func Marshall(template *cloudformation.Template) ([]byte, error) {
 	}
 
 	if input, ok := unmarshalled.(map[string]interface{}); ok {
+		if parameters, ok := input["Parameters"].(map[string]interface{}); ok {
+			if resources, ok := input["Resources"]; ok {
+				input["Resources"] = refListParameters(resources, listParameters(parameters))
+			}
+		}
 		if resources, ok := input["Resources"]; ok {
 			for _, uresource := range resources.(map[string]interface{}) {
 				if resource, ok := uresource.(map[string]interface{}); ok {
+					if dependsOn, ok := resource["DependsOn"].([]interface{}); ok {
+						sort.Slice(dependsOn, func(i, j int) bool {
+							return fmt.Sprint(dependsOn[i]) < fmt.Sprint(dependsOn[j])
+						})
+					}
 					if resource["Type"] == "AWS::ECS::TaskDefinition" {
 						properties := resource["Properties"].(map[string]interface{})
+						completes := completedContainers(properties["ContainerDefinitions"].([]interface{}))
 						for _, def := range properties["ContainerDefinitions"].([]interface{}) {
 							containerDefinition := def.(map[string]interface{})
-							if strings.HasSuffix(containerDefinition["Name"].(string), "_InitContainer") {
+							name := containerDefinition["Name"].(string)
+							if strings.HasSuffix(name, "_InitContainer") || completes[name] {
 								containerDefinition["Essential"] = "false"
 							}
 						}
@@ -43,3 +58,54 @@ func Marshall(template *cloudformation.Template) ([]byte, error) {
 	}
 	return raw, err
 }
+
+// completedContainers returns the names of the containers other ones wait to complete, which can't be essential
+func completedContainers(definitions []interface{}) map[string]bool {
+	completes := map[string]bool{}
+	for _, def := range definitions {
+		dependencies, _ := def.(map[string]interface{})["DependsOn"].([]interface{})
+		for _, d := range dependencies {
+			dependency := d.(map[string]interface{})
+			if dependency["Condition"] == "SUCCESS" || dependency["Condition"] == "COMPLETE" {
+				completes[dependency["ContainerName"].(string)] = true
+			}
+		}
+	}
+	return completes
+}
+
+// listParameters returns the names of the template parameters which are of a List<> type
+func listParameters(parameters map[string]interface{}) map[string]bool {
+	lists := map[string]bool{}
+	for name, p := range parameters {
+		if parameter, ok := p.(map[string]interface{}); ok {
+			if t, ok := parameter["Type"].(string); ok && strings.HasPrefix(t, "List<") {
+				lists[name] = true
+			}
+		}
+	}
+	return lists
+}
+
+// refListParameters replaces `[{"Ref": "Parameter"}]` with `{"Ref": "Parameter"}` for List<> parameters, as goformation
+// only allows a Ref within a list of strings, while it resolves into the list itself
+func refListParameters(node interface{}, lists map[string]bool) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, value := range n {
+			n[key] = refListParameters(value, lists)
+		}
+	case []interface{}:
+		if len(n) == 1 {
+			if ref, ok := n[0].(map[string]interface{}); ok && len(ref) == 1 {
+				if name, ok := ref["Ref"].(string); ok && lists[name] {
+					return ref
+				}
+			}
+		}
+		for i, value := range n {
+			n[i] = refListParameters(value, lists)
+		}
+	}
+	return node
+}
@@ -14,6 +14,7 @@ type API interface {
 	GetDefaultVPC(ctx context.Context) (string, error)
 	VpcExists(ctx context.Context, vpcID string) (bool, error)
 	GetSubNets(ctx context.Context, vpcID string) ([]string, error)
+	GetSubnetZones(ctx context.Context, subnetIDs []string) (map[string]string, error)
 
 	StackExists(ctx context.Context, name string) (bool, error)
 	CreateStack(ctx context.Context, name string, template *cloudformation.Template, parameters map[string]string) error
@@ -28,12 +29,26 @@ type API interface {
 
 	DescribeServices(ctx context.Context, cluster string, arns []string) ([]compose.ServiceStatus, error)
 
+	CreateDeployment(ctx context.Context, application string, group string, appSpec string) (string, error)
+	DescribeDeployment(ctx context.Context, id string) (compose.DeploymentStatus, error)
+
+	CreateRepository(ctx context.Context, name string, project string) (string, error)
+	GetRegistryCredentials(ctx context.Context) (compose.RegistryCredentials, error)
+
 	LoadBalancerExists(ctx context.Context, arn string) (bool, error)
 	GetLoadBalancerURL(ctx context.Context, arn string) (string, error)
 
 	ClusterExists(ctx context.Context, name string) (bool, error)
 
+	FindFileSystem(ctx context.Context, tags map[string]string) (string, error)
+
 	GetLogs(ctx context.Context, name string, consumer compose.LogConsumer) error
+	GetTaskLogs(ctx context.Context, logGroup string, streams []string, startTime int64, consumer compose.LogConsumer) (int64, error)
+
+	RunTask(ctx context.Context, task compose.TaskRequest) (string, error)
+	DescribeTasks(ctx context.Context, cluster string, arns ...string) ([]compose.TaskStatus, error)
+	ListTasks(ctx context.Context, cluster string, service string) ([]string, error)
+	ExecuteCommand(ctx context.Context, cluster string, task string, container string, command string) (compose.ExecSession, error)
 
 	CreateSecret(ctx context.Context, secret compose.Secret) (string, error)
 	InspectSecret(ctx context.Context, id string) (compose.Secret, error)
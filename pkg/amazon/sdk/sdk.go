@@ -2,23 +2,32 @@ package sdk
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	cloudformation2 "github.com/docker/ecs-plugin/pkg/amazon/cloudformation"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+	"github.com/aws/aws-sdk-go/service/codedeploy/codedeployiface"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/aws/aws-sdk-go/service/efs"
+	"github.com/aws/aws-sdk-go/service/efs/efsiface"
 	"github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/aws/aws-sdk-go/service/elbv2/elbv2iface"
 	"github.com/aws/aws-sdk-go/service/iam"
@@ -40,6 +49,9 @@ type sdk struct {
 	IAM  iamiface.IAMAPI
 	CF   cloudformationiface.CloudFormationAPI
 	SM   secretsmanageriface.SecretsManagerAPI
+	CD   codedeployiface.CodeDeployAPI
+	ECR  ecriface.ECRAPI
+	EFS  efsiface.EFSAPI
 }
 
 func NewAPI(sess *session.Session) API {
@@ -54,6 +66,9 @@ func NewAPI(sess *session.Session) API {
 		IAM: iam.New(sess),
 		CF:  cloudformation.New(sess),
 		SM:  secretsmanager.New(sess),
+		CD:  codedeploy.New(sess),
+		ECR: ecr.New(sess),
+		EFS: efs.New(sess),
 	}
 }
 
@@ -85,6 +100,32 @@ func (s sdk) ClusterExists(ctx context.Context, name string) (bool, error) {
 	return len(clusters.Clusters) > 0, nil
 }
 
+// FindFileSystem returns the ID of an available EFS file system with all the given tags, or an empty string if there is
+// none
+func (s sdk) FindFileSystem(ctx context.Context, tags map[string]string) (string, error) {
+	logrus.Debug("Find file system tagged ", tags)
+	id := ""
+	err := s.EFS.DescribeFileSystemsPagesWithContext(ctx, &efs.DescribeFileSystemsInput{}, func(page *efs.DescribeFileSystemsOutput, lastPage bool) bool {
+		for _, fileSystem := range page.FileSystems {
+			if aws.StringValue(fileSystem.LifeCycleState) != efs.LifeCycleStateAvailable {
+				continue
+			}
+			matches := 0
+			for _, tag := range fileSystem.Tags {
+				if v, ok := tags[aws.StringValue(tag.Key)]; ok && v == aws.StringValue(tag.Value) {
+					matches++
+				}
+			}
+			if matches == len(tags) {
+				id = aws.StringValue(fileSystem.FileSystemId)
+				return false
+			}
+		}
+		return true
+	})
+	return id, err
+}
+
 func (s sdk) CreateCluster(ctx context.Context, name string) (string, error) {
 	logrus.Debug("Create cluster ", name)
 	response, err := s.ECS.CreateClusterWithContext(ctx, &ecs.CreateClusterInput{ClusterName: aws.String(name)})
@@ -134,13 +175,44 @@ func (s sdk) GetSubNets(ctx context.Context, vpcID string) ([]string, error) {
 		return nil, err
 	}
 
-	ids := []string{}
+	// select a single subnet per availability zone, preferring the default one
+	zones := map[string]*ec2.Subnet{}
 	for _, subnet := range subnets.Subnets {
-		ids = append(ids, *subnet.SubnetId)
+		zone := aws.StringValue(subnet.AvailabilityZone)
+		if selected, ok := zones[zone]; ok && (aws.BoolValue(selected.DefaultForAz) || !aws.BoolValue(subnet.DefaultForAz)) {
+			continue
+		}
+		zones[zone] = subnet
+	}
+	names := []string{}
+	for zone := range zones {
+		names = append(names, zone)
+	}
+	sort.Strings(names)
+
+	ids := []string{}
+	for _, zone := range names {
+		ids = append(ids, aws.StringValue(zones[zone].SubnetId))
 	}
 	return ids, nil
 }
 
+// GetSubnetZones returns the availability zone of each subnet
+func (s sdk) GetSubnetZones(ctx context.Context, subnetIDs []string) (map[string]string, error) {
+	logrus.Debug("Retrieve SubNets availability zones")
+	subnets, err := s.EC2.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{
+		SubnetIds: aws.StringSlice(subnetIDs),
+	})
+	if err != nil {
+		return nil, err
+	}
+	zones := map[string]string{}
+	for _, subnet := range subnets.Subnets {
+		zones[aws.StringValue(subnet.SubnetId)] = aws.StringValue(subnet.AvailabilityZone)
+	}
+	return zones, nil
+}
+
 func (s sdk) GetRoleArn(ctx context.Context, name string) (string, error) {
 	role, err := s.IAM.GetRoleWithContext(ctx, &iam.GetRoleInput{
 		RoleName: aws.String(name),
@@ -409,34 +481,280 @@ func (s sdk) DeleteSecret(ctx context.Context, id string, recover bool) error {
 }
 
 func (s sdk) GetLogs(ctx context.Context, name string, consumer compose.LogConsumer) error {
-	logGroup := fmt.Sprintf("/docker-compose/%s", name)
-	var startTime int64
+	logGroups, err := s.getLogGroups(ctx, name)
+	if err != nil {
+		return err
+	}
+	startTimes := map[string]int64{}
 	for {
-		var hasMore = true
-		var token *string
-		for hasMore {
-			events, err := s.CW.FilterLogEvents(&cloudwatchlogs.FilterLogEventsInput{
-				LogGroupName: aws.String(logGroup),
-				NextToken:    token,
-				StartTime:    aws.Int64(startTime),
-			})
-			if err != nil {
-				return err
+		for _, logGroup := range logGroups {
+			var hasMore = true
+			var token *string
+			for hasMore {
+				events, err := s.CW.FilterLogEvents(&cloudwatchlogs.FilterLogEventsInput{
+					LogGroupName: aws.String(logGroup),
+					NextToken:    token,
+					StartTime:    aws.Int64(startTimes[logGroup]),
+				})
+				if err != nil {
+					return err
+				}
+				if events.NextToken == nil {
+					hasMore = false
+				} else {
+					token = events.NextToken
+				}
+
+				for _, event := range events.Events {
+					p := strings.Split(aws.StringValue(event.LogStreamName), "/")
+					consumer.Log(p[1], p[2], aws.StringValue(event.Message))
+					startTimes[logGroup] = *event.IngestionTime
+				}
 			}
-			if events.NextToken == nil {
-				hasMore = false
-			} else {
-				token = events.NextToken
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// getLogGroups lists the project log group and the log groups dedicated to its services
+func (s sdk) getLogGroups(ctx context.Context, name string) ([]string, error) {
+	prefix := fmt.Sprintf("/docker-compose/%s", name)
+	logGroups := []string{}
+	err := s.CW.DescribeLogGroupsPagesWithContext(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(prefix),
+	}, func(page *cloudwatchlogs.DescribeLogGroupsOutput, lastPage bool) bool {
+		for _, group := range page.LogGroups {
+			logGroup := aws.StringValue(group.LogGroupName)
+			// skip log groups of other projects sharing the same prefix
+			if logGroup == prefix || strings.HasPrefix(logGroup, prefix+"/") {
+				logGroups = append(logGroups, logGroup)
 			}
+		}
+		return true
+	})
+	return logGroups, err
+}
 
-			for _, event := range events.Events {
-				p := strings.Split(aws.StringValue(event.LogStreamName), "/")
-				consumer.Log(p[1], p[2], aws.StringValue(event.Message))
-				startTime = *event.IngestionTime
+// GetTaskLogs collects events logged since startTime to a set of log streams within a log group, and returns the
+// time to collect following events from
+func (s sdk) GetTaskLogs(ctx context.Context, logGroup string, streams []string, startTime int64, consumer compose.LogConsumer) (int64, error) {
+	var token *string
+	for {
+		events, err := s.CW.FilterLogEventsWithContext(ctx, &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName:   aws.String(logGroup),
+			LogStreamNames: aws.StringSlice(streams),
+			NextToken:      token,
+			StartTime:      aws.Int64(startTime),
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == cloudwatchlogs.ErrCodeResourceNotFoundException {
+			// log streams are created once containers are started
+			return startTime, nil
+		}
+		if err != nil {
+			return startTime, err
+		}
+		for _, event := range events.Events {
+			p := strings.Split(aws.StringValue(event.LogStreamName), "/")
+			consumer.Log(p[1], p[2], aws.StringValue(event.Message))
+			if next := aws.Int64Value(event.Timestamp) + 1; next > startTime {
+				startTime = next
 			}
 		}
-		time.Sleep(500 * time.Millisecond)
+		if events.NextToken == nil {
+			return startTime, nil
+		}
+		token = events.NextToken
+	}
+}
+
+func (s sdk) RunTask(ctx context.Context, task compose.TaskRequest) (string, error) {
+	logrus.Debug("Run task ", task.TaskDefinition)
+	input := &ecs.RunTaskInput{
+		Cluster:        aws.String(task.Cluster),
+		Count:          aws.Int64(1),
+		StartedBy:      aws.String("docker-compose"),
+		TaskDefinition: aws.String(task.TaskDefinition),
+		NetworkConfiguration: &ecs.NetworkConfiguration{
+			AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
+				AssignPublicIp: aws.String(task.AssignPublicIP),
+				SecurityGroups: aws.StringSlice(task.SecurityGroups),
+				Subnets:        aws.StringSlice(task.Subnets),
+			},
+		},
+	}
+	if task.LaunchType != "" {
+		input.LaunchType = aws.String(task.LaunchType)
+	}
+	for _, item := range task.CapacityProviderStrategy {
+		input.CapacityProviderStrategy = append(input.CapacityProviderStrategy, &ecs.CapacityProviderStrategyItem{
+			Base:             aws.Int64(int64(item.Base)),
+			CapacityProvider: aws.String(item.CapacityProvider),
+			Weight:           aws.Int64(int64(item.Weight)),
+		})
+	}
+	if task.PlatformVersion != "" {
+		input.PlatformVersion = aws.String(task.PlatformVersion)
+	}
+	if len(task.Command) > 0 {
+		input.Overrides = &ecs.TaskOverride{
+			ContainerOverrides: []*ecs.ContainerOverride{
+				{
+					Name:    aws.String(task.Container),
+					Command: aws.StringSlice(task.Command),
+				},
+			},
+		}
+	}
+	run, err := s.ECS.RunTaskWithContext(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	if len(run.Failures) > 0 {
+		return "", fmt.Errorf("failed to run task: %s", aws.StringValue(run.Failures[0].Reason))
+	}
+	return aws.StringValue(run.Tasks[0].TaskArn), nil
+}
+
+func (s sdk) DescribeTasks(ctx context.Context, cluster string, arns ...string) ([]compose.TaskStatus, error) {
+	client, ok := s.ECS.(*ecs.ECS)
+	if !ok {
+		return nil, fmt.Errorf("ECS client doesn't support DescribeTasks")
+	}
+	tasks := &describeTasksOutput{}
+	req := client.NewRequest(&request.Operation{
+		Name:       "DescribeTasks",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, &ecs.DescribeTasksInput{
+		Cluster: aws.String(cluster),
+		Tasks:   aws.StringSlice(arns),
+	}, tasks)
+	req.SetContext(ctx)
+	if err := req.Send(); err != nil {
+		return nil, err
+	}
+	status := []compose.TaskStatus{}
+	for _, task := range tasks.Tasks {
+		containers := []compose.ContainerStatus{}
+		for _, container := range task.Containers {
+			c := compose.ContainerStatus{
+				Name:      aws.StringValue(container.Name),
+				Reason:    aws.StringValue(container.Reason),
+				RuntimeID: aws.StringValue(container.RuntimeID),
+			}
+			if container.ExitCode != nil {
+				exitCode := int(aws.Int64Value(container.ExitCode))
+				c.ExitCode = &exitCode
+			}
+			for _, agent := range container.ManagedAgents {
+				if aws.StringValue(agent.Name) == "ExecuteCommandAgent" {
+					c.ExecuteCommandAgent = aws.StringValue(agent.LastStatus)
+				}
+			}
+			containers = append(containers, c)
+		}
+		status = append(status, compose.TaskStatus{
+			ARN:           aws.StringValue(task.TaskArn),
+			Status:        aws.StringValue(task.LastStatus),
+			StoppedReason: aws.StringValue(task.StoppedReason),
+			Containers:    containers,
+		})
+	}
+	return status, nil
+}
+
+// describeTasksOutput declares the part of the ECS DescribeTasks output status reports, with the managed agents of
+// containers the aws-sdk-go release this module depends on doesn't model yet. FIXME use ecs.DescribeTasksOutput once
+// aws-sdk-go is updated, as for executeCommandInput.
+type describeTasksOutput struct {
+	_ struct{} `type:"structure"`
+
+	Tasks []*describedTask `locationName:"tasks" type:"list"`
+}
+
+type describedTask struct {
+	_ struct{} `type:"structure"`
+
+	Containers    []*describedContainer `locationName:"containers" type:"list"`
+	LastStatus    *string               `locationName:"lastStatus" type:"string"`
+	StoppedReason *string               `locationName:"stoppedReason" type:"string"`
+	TaskArn       *string               `locationName:"taskArn" type:"string"`
+}
+
+type describedContainer struct {
+	_ struct{} `type:"structure"`
+
+	ExitCode      *int64          `locationName:"exitCode" type:"integer"`
+	ManagedAgents []*managedAgent `locationName:"managedAgents" type:"list"`
+	Name          *string         `locationName:"name" type:"string"`
+	Reason        *string         `locationName:"reason" type:"string"`
+	RuntimeID     *string         `locationName:"runtimeId" type:"string"`
+}
+
+type managedAgent struct {
+	_ struct{} `type:"structure"`
+
+	LastStatus *string `locationName:"lastStatus" type:"string"`
+	Name       *string `locationName:"name" type:"string"`
+}
+
+// executeCommandInput and executeCommandOutput declare the ECS ExecuteCommand operation, which the aws-sdk-go release
+// this module depends on doesn't model yet. FIXME replace them by ecs.ExecuteCommandWithContext once aws-sdk-go is
+// updated to a release modelling ECS Exec (v1.37.24 or later)
+type executeCommandInput struct {
+	_ struct{} `type:"structure"`
+
+	Cluster     *string `locationName:"cluster" type:"string"`
+	Command     *string `locationName:"command" type:"string"`
+	Container   *string `locationName:"container" type:"string"`
+	Interactive *bool   `locationName:"interactive" type:"boolean"`
+	Task        *string `locationName:"task" type:"string"`
+}
+
+type executeCommandOutput struct {
+	_ struct{} `type:"structure"`
+
+	Session *executeCommandSession `locationName:"session" type:"structure"`
+}
+
+type executeCommandSession struct {
+	_ struct{} `type:"structure"`
+
+	SessionID  *string `locationName:"sessionId" type:"string"`
+	StreamURL  *string `locationName:"streamUrl" type:"string"`
+	TokenValue *string `locationName:"tokenValue" type:"string" sensitive:"true"`
+}
+
+func (s sdk) ExecuteCommand(ctx context.Context, cluster string, task string, container string, command string) (compose.ExecSession, error) {
+	logrus.Debug("Execute command in container ", container)
+	client, ok := s.ECS.(*ecs.ECS)
+	if !ok {
+		return compose.ExecSession{}, fmt.Errorf("ECS client doesn't support ExecuteCommand")
+	}
+	output := &executeCommandOutput{}
+	req := client.NewRequest(&request.Operation{
+		Name:       "ExecuteCommand",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, &executeCommandInput{
+		Cluster:     aws.String(cluster),
+		Command:     aws.String(command),
+		Container:   aws.String(container),
+		Interactive: aws.Bool(true),
+		Task:        aws.String(task),
+	}, output)
+	req.SetContext(ctx)
+	if err := req.Send(); err != nil {
+		return compose.ExecSession{}, err
+	}
+	if output.Session == nil {
+		return compose.ExecSession{}, fmt.Errorf("no session returned to execute command in container %s", container)
 	}
+	return compose.ExecSession{
+		SessionID:  aws.StringValue(output.Session.SessionID),
+		StreamURL:  aws.StringValue(output.Session.StreamURL),
+		TokenValue: aws.StringValue(output.Session.TokenValue),
+	}, nil
 }
 
 func (s sdk) DescribeServices(ctx context.Context, cluster string, arns []string) ([]compose.ServiceStatus, error) {
@@ -481,6 +799,65 @@ func (s sdk) DescribeServices(ctx context.Context, cluster string, arns []string
 	return status, nil
 }
 
+func (s sdk) CreateDeployment(ctx context.Context, application string, group string, appSpec string) (string, error) {
+	logrus.Debug("Create CodeDeploy deployment")
+	deployment, err := s.CD.CreateDeploymentWithContext(ctx, &codedeploy.CreateDeploymentInput{
+		ApplicationName:     aws.String(application),
+		DeploymentGroupName: aws.String(group),
+		Revision: &codedeploy.RevisionLocation{
+			AppSpecContent: &codedeploy.AppSpecContent{
+				Content: aws.String(appSpec),
+			},
+			RevisionType: aws.String(codedeploy.RevisionLocationTypeAppSpecContent),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(deployment.DeploymentId), nil
+}
+
+func (s sdk) DescribeDeployment(ctx context.Context, id string) (compose.DeploymentStatus, error) {
+	deployment, err := s.CD.GetDeploymentWithContext(ctx, &codedeploy.GetDeploymentInput{
+		DeploymentId: aws.String(id),
+	})
+	if err != nil {
+		return compose.DeploymentStatus{}, err
+	}
+	status := compose.DeploymentStatus{
+		ID:     id,
+		Status: aws.StringValue(deployment.DeploymentInfo.Status),
+	}
+	if info := deployment.DeploymentInfo.ErrorInformation; info != nil {
+		status.Message = aws.StringValue(info.Message)
+	}
+
+	targets, err := s.CD.ListDeploymentTargetsWithContext(ctx, &codedeploy.ListDeploymentTargetsInput{
+		DeploymentId: aws.String(id),
+	})
+	if err != nil {
+		return status, err
+	}
+	for _, target := range targets.TargetIds {
+		t, err := s.CD.GetDeploymentTargetWithContext(ctx, &codedeploy.GetDeploymentTargetInput{
+			DeploymentId: aws.String(id),
+			TargetId:     target,
+		})
+		if err != nil {
+			return status, err
+		}
+		if t.DeploymentTarget.EcsTarget == nil {
+			continue
+		}
+		for _, taskSet := range t.DeploymentTarget.EcsTarget.TaskSetsInfo {
+			if aws.StringValue(taskSet.TaskSetLabel) == codedeploy.TargetLabelGreen {
+				status.TrafficWeight = aws.Float64Value(taskSet.TrafficWeight)
+			}
+		}
+	}
+	return status, nil
+}
+
 func (s sdk) getURLWithPortMapping(ctx context.Context, targetGroupArns []string) ([]compose.LoadBalancer, error) {
 	if len(targetGroupArns) == 0 {
 		return nil, nil
@@ -522,10 +899,17 @@ func (s sdk) getURLWithPortMapping(ctx context.Context, targetGroupArns []string
 			if lb == nil {
 				continue
 			}
+			published, err := s.getListenerPort(ctx, aws.StringValue(lbarn), aws.StringValue(tg.TargetGroupArn))
+			if err != nil {
+				return nil, err
+			}
+			if published == 0 {
+				published = int(aws.Int64Value(tg.Port))
+			}
 			loadBalancers = append(loadBalancers, compose.LoadBalancer{
 				URL:           aws.StringValue(lb.DNSName),
 				TargetPort:    int(aws.Int64Value(tg.Port)),
-				PublishedPort: int(aws.Int64Value(tg.Port)),
+				PublishedPort: published,
 				Protocol:      aws.StringValue(tg.Protocol),
 			})
 
@@ -534,10 +918,56 @@ func (s sdk) getURLWithPortMapping(ctx context.Context, targetGroupArns []string
 	return loadBalancers, nil
 }
 
-func (s sdk) ListTasks(ctx context.Context, cluster string, family string) ([]string, error) {
+// getListenerPort returns the port of the load balancer listener forwarding to target group
+func (s sdk) getListenerPort(ctx context.Context, loadBalancerArn string, targetGroupArn string) (int, error) {
+	listeners, err := s.ELB.DescribeListenersWithContext(ctx, &elbv2.DescribeListenersInput{
+		LoadBalancerArn: aws.String(loadBalancerArn),
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, listener := range listeners.Listeners {
+		if forwardsTo(listener.DefaultActions, targetGroupArn) {
+			return int(aws.Int64Value(listener.Port)), nil
+		}
+		// services set with routing rules share the listener
+		rules, err := s.ELB.DescribeRulesWithContext(ctx, &elbv2.DescribeRulesInput{
+			ListenerArn: listener.ListenerArn,
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, rule := range rules.Rules {
+			if forwardsTo(rule.Actions, targetGroupArn) {
+				return int(aws.Int64Value(listener.Port)), nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+func forwardsTo(actions []*elbv2.Action, targetGroupArn string) bool {
+	for _, action := range actions {
+		if aws.StringValue(action.TargetGroupArn) == targetGroupArn {
+			return true
+		}
+		if action.ForwardConfig == nil {
+			continue
+		}
+		for _, tuple := range action.ForwardConfig.TargetGroups {
+			if aws.StringValue(tuple.TargetGroupArn) == targetGroupArn {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s sdk) ListTasks(ctx context.Context, cluster string, service string) ([]string, error) {
 	tasks, err := s.ECS.ListTasksWithContext(ctx, &ecs.ListTasksInput{
-		Cluster: aws.String(cluster),
-		Family:  aws.String(family),
+		Cluster:       aws.String(cluster),
+		DesiredStatus: aws.String(ecs.DesiredStatusRunning),
+		ServiceName:   aws.String(service),
 	})
 	if err != nil {
 		return nil, err
@@ -565,6 +995,57 @@ func (s sdk) GetPublicIPs(ctx context.Context, interfaces ...string) (map[string
 	return publicIPs, nil
 }
 
+func (s sdk) CreateRepository(ctx context.Context, name string, project string) (string, error) {
+	logrus.Debug("Check if repository exists: ", name)
+	repositories, err := s.ECR.DescribeRepositoriesWithContext(ctx, &ecr.DescribeRepositoriesInput{
+		RepositoryNames: aws.StringSlice([]string{name}),
+	})
+	if err == nil {
+		return aws.StringValue(repositories.Repositories[0].RepositoryUri), nil
+	}
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ecr.ErrCodeRepositoryNotFoundException {
+		return "", err
+	}
+	logrus.Debug("Create repository ", name)
+	repository, err := s.ECR.CreateRepositoryWithContext(ctx, &ecr.CreateRepositoryInput{
+		RepositoryName: aws.String(name),
+		Tags: []*ecr.Tag{
+			{
+				Key:   aws.String(compose.ProjectTag),
+				Value: aws.String(project),
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(repository.Repository.RepositoryUri), nil
+}
+
+func (s sdk) GetRegistryCredentials(ctx context.Context) (compose.RegistryCredentials, error) {
+	token, err := s.ECR.GetAuthorizationTokenWithContext(ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return compose.RegistryCredentials{}, err
+	}
+	if len(token.AuthorizationData) == 0 {
+		return compose.RegistryCredentials{}, fmt.Errorf("no authorization token returned by ECR")
+	}
+	data := token.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(aws.StringValue(data.AuthorizationToken))
+	if err != nil {
+		return compose.RegistryCredentials{}, err
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return compose.RegistryCredentials{}, fmt.Errorf("invalid authorization token returned by ECR")
+	}
+	return compose.RegistryCredentials{
+		Username:      parts[0],
+		Password:      parts[1],
+		ServerAddress: aws.StringValue(data.ProxyEndpoint),
+	}, nil
+}
+
 func (s sdk) LoadBalancerExists(ctx context.Context, arn string) (bool, error) {
 	logrus.Debug("CheckRequirements if LoadBalancer exists: ", arn)
 	lbs, err := s.ELB.DescribeLoadBalancersWithContext(ctx, &elbv2.DescribeLoadBalancersInput{
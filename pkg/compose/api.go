@@ -18,6 +18,8 @@ type API interface {
 	Convert(project *types.Project) (*cloudformation.Template, error)
 	Logs(ctx context.Context, options *cli.ProjectOptions, writer io.Writer) error
 	Ps(ctx context.Context, options *cli.ProjectOptions) ([]ServiceStatus, error)
+	Run(ctx context.Context, options *cli.ProjectOptions, service string, command []string, writer io.Writer) (int, error)
+	Exec(ctx context.Context, options *cli.ProjectOptions, service string, command []string) error
 
 	CreateSecret(ctx context.Context, secret Secret) (string, error)
 	InspectSecret(ctx context.Context, id string) (Secret, error)
@@ -4,4 +4,5 @@ const (
 	ProjectTag = "com.docker.compose.project"
 	NetworkTag = "com.docker.compose.network"
 	ServiceTag = "com.docker.compose.service"
+	VolumeTag  = "com.docker.compose.volume"
 )
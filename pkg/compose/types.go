@@ -25,6 +25,62 @@ type ServiceStatus struct {
 	LoadBalancers []LoadBalancer
 }
 
+// TaskRequest describes a one-off task to run from a service task definition
+type TaskRequest struct {
+	Cluster        string
+	TaskDefinition string
+	LaunchType     string
+	// CapacityProviderStrategy is used instead of LaunchType when set
+	CapacityProviderStrategy []CapacityProviderStrategyItem
+	PlatformVersion          string
+	Subnets                  []string
+	SecurityGroups           []string
+	AssignPublicIP           string
+	// Container is the container to run Command in, instead of the image default command
+	Container string
+	Command   []string
+}
+
+type CapacityProviderStrategyItem struct {
+	CapacityProvider string
+	Weight           int
+	Base             int
+}
+
+type TaskStatus struct {
+	ARN           string
+	Status        string
+	StoppedReason string
+	Containers    []ContainerStatus
+}
+
+type ContainerStatus struct {
+	Name string
+	// ExitCode is nil until container has stopped
+	ExitCode *int
+	Reason   string
+	// RuntimeID identifies the container on its host, as required to open an ECS Exec session
+	RuntimeID string
+	// ExecuteCommandAgent is the status of the agent running ECS Exec sessions in the container, if enabled
+	ExecuteCommandAgent string
+}
+
+// ExecSession is the SSM session ECS Exec opens into a container, serialized as session-manager-plugin expects it
+type ExecSession struct {
+	SessionID  string `json:"SessionId"`
+	StreamURL  string `json:"StreamUrl"`
+	TokenValue string `json:"TokenValue"`
+}
+
+// DeploymentStatus is the state of a CodeDeploy deployment of a blue/green service
+type DeploymentStatus struct {
+	ID      string
+	Status  string
+	Message string
+	// TrafficWeight is the percentage of production traffic routed to the replacement tasks
+	TrafficWeight float64
+}
+
 const (
 	StackCreate = iota
 	StackUpdate
@@ -72,3 +128,10 @@ func (s Secret) GetCredString() (string, error) {
 	}
 	return string(b), nil
 }
+
+// RegistryCredentials authenticate to the container registry service images are pushed to
+type RegistryCredentials struct {
+	Username      string
+	Password      string
+	ServerAddress string
+}
@@ -1,15 +1,37 @@
 package compose
 
 const (
-	ExtensionSecurityGroup   = "x-aws-securitygroup"
-	ExtensionVPC             = "x-aws-vpc"
-	ExtensionPullCredentials = "x-aws-pull_credentials"
-	ExtensionLB              = "x-aws-loadbalancer"
-	ExtensionCluster         = "x-aws-cluster"
-	ExtensionKeys            = "x-aws-keys"
-	ExtensionMinPercent      = "x-aws-min_percent"
-	ExtensionMaxPercent      = "x-aws-max_percent"
-	ExtensionRetention       = "x-aws-logs_retention"
-	ExtensionRole            = "x-aws-role"
-	ExtensionManagedPolicies = "x-aws-policies"
+	ExtensionSecurityGroup            = "x-aws-securitygroup"
+	ExtensionVPC                      = "x-aws-vpc"
+	ExtensionPullCredentials          = "x-aws-pull_credentials"
+	ExtensionLB                       = "x-aws-loadbalancer"
+	ExtensionCluster                  = "x-aws-cluster"
+	ExtensionKeys                     = "x-aws-keys"
+	ExtensionMinPercent               = "x-aws-min_percent"
+	ExtensionMaxPercent               = "x-aws-max_percent"
+	ExtensionRetention                = "x-aws-logs_retention"
+	ExtensionLogsKMSKey               = "x-aws-logs_kms_key"
+	ExtensionLogsSubscription         = "x-aws-logs_subscription"
+	ExtensionRole                     = "x-aws-role"
+	ExtensionManagedPolicies          = "x-aws-policies"
+	ExtensionExecutionRole            = "x-aws-execution_role"
+	ExtensionExecutionPolicies        = "x-aws-execution_policies"
+	ExtensionEFS                      = "x-aws-efs"
+	ExtensionHealthCheck              = "x-aws-healthcheck"
+	ExtensionCertificate              = "x-aws-certificate"
+	ExtensionSSLPolicy                = "x-aws-ssl_policy"
+	ExtensionHTTPSRedirect            = "x-aws-https_redirect"
+	ExtensionRouting                  = "x-aws-routing"
+	ExtensionAutoScaling              = "x-aws-autoscaling"
+	ExtensionCapacityProviderStrategy = "x-aws-capacity_provider_strategy"
+	ExtensionEC2                      = "x-aws-ec2"
+	ExtensionSidecarOf                = "x-aws-sidecar-of"
+	ExtensionSubnets                  = "x-aws-subnets"
+	ExtensionAssignPublicIP           = "x-aws-assign_public_ip"
+	ExtensionLoadBalancerScheme       = "x-aws-loadbalancer_scheme"
+	ExtensionDeployment               = "x-aws-deployment"
+	ExtensionTestListener             = "x-aws-test_listener"
+	ExtensionSchedule                 = "x-aws-schedule"
+	ExtensionDependsOn                = "x-aws-depends_on"
+	ExtensionExec                     = "x-aws-exec"
 )